@@ -1,10 +1,16 @@
 package bundleinstall
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/fs"
@@ -15,12 +21,15 @@ import (
 //go:generate faux --interface InstallProcess --output fakes/install_process.go
 //go:generate faux --interface EntryResolver --output fakes/entry_resolver.go
 //go:generate faux --interface SBOMGenerator --output fakes/sbom_generator.go
+//go:generate faux --interface GitCache --output fakes/git_cache.go
+//go:generate faux --interface GemfileDependencyParser --output fakes/gemfile_dependency_parser.go
 
 // InstallProcess defines the interface for executing the "bundle install"
 // build process.
 type InstallProcess interface {
-	ShouldRun(metadata map[string]interface{}, workingDir string) (should bool, checksum string, rubyVersion string, err error)
-	Execute(workingDir, layerPath string, config map[string]string, keepBuildFiles bool) error
+	ShouldRun(metadata map[string]interface{}, workingDir string, manifest Manifest, settings InstallSettings) (reasons []string, key CacheKey, abi RubyABI, err error)
+	Execute(workingDir, layerPath, downloadCachePath string, config map[string]string, keepBuildFiles bool) error
+	Configure(workingDir, layerPath string, config map[string]string) error
 }
 
 // EntryResolver defines the interface for determining what phases of the
@@ -33,6 +42,19 @@ type SBOMGenerator interface {
 	Generate(dir string) (sbom.SBOM, error)
 }
 
+// GitCache defines the interface for verifying the cached clones of the GIT
+// sources in a lockfile.
+type GitCache interface {
+	Verify(path string, lock lockfile.Lockfile) error
+}
+
+// GemfileDependencyParser defines the interface for parsing the gems declared
+// by the Gemfile of the application, and the groups they belong to.
+type GemfileDependencyParser interface {
+	ParseDependencies(path string) (GemfileDependencies, error)
+	ParseGroups(path string) (GemfileGroups, error)
+}
+
 // Build will return a packit.BuildFunc that will be invoked during the build
 // phase of the buildpack lifecycle.
 //
@@ -44,10 +66,38 @@ type SBOMGenerator interface {
 // If gems are required during the build phase, Build will ensure that all
 // gems, including those in the "development" and "test" groups are installed
 // into a layer that is made available during the remainder of the build phase.
+// The groups can be selected with $BP_BUNDLE_BUILD_WITHOUT,
+// $BP_BUNDLE_BUILD_WITH and $BP_BUNDLE_BUILD_ONLY.
 //
 // If gems are required during the launch phase, Build will ensure that only
 // those gems that are not in the "development" or "test" groups are installed
-// into a layer that is made available during the launch phase.
+// into a layer that is made available during the launch phase. The groups can
+// be selected with $BP_BUNDLE_WITHOUT, $BP_BUNDLE_WITH and $BP_BUNDLE_ONLY.
+//
+// Buildpacks that require gems can additionally ask for groups to be
+// installed, or excluded, through the "gems" build plan entry metadata, as
+// described by MergeGemGroups. The group selection is recorded in the layer
+// metadata, and a change to it causes the gems to be installed again.
+//
+// A layer is reused unless the InstallProcess, the stack or the group
+// selection gives a reason to install the gems again. Build logs the reasons
+// and records them in the layer metadata as "install_reasons".
+//
+// The facts about the ABI of Ruby, as reported by RbConfig, are recorded in
+// the layer metadata as "ruby_abi". Gems are reinstalled when any of them
+// change, and, with $BP_BUNDLE_REBUILD_ON_RUBY_PATCH set, whenever the version
+// of Ruby changes, including patch releases.
+//
+// As the build layer is cached, Build removes the gems that it holds for
+// any other Ruby ABI, such as those installed before a Ruby upgrade, so that
+// they are neither kept in the cache nor copied into the launch layer.
+//
+// The OS, architecture and distribution of the build target are recorded in
+// the layer metadata, and a layer is cleared when they change, so that native
+// extensions are never reused on a target they were not compiled for.
+//
+// With $BP_BUNDLE_FORCE_INSTALL or $BP_BUNDLE_CLEAN_CACHE set, Build clears
+// both layers and installs the gems from scratch.
 //
 // If gems are required during both the build and launch phases, Build will
 // provide both of the above layers with their sets of gems. These layers
@@ -55,14 +105,53 @@ type SBOMGenerator interface {
 // or launch phase.
 //
 // To improve performance when installing gems for use in both the build and
-// launch phases, Build will copy the contents of the build layer into the
-// launch layer before executing the launch layer installation process. This
-// will result in the launch layer installation process performing an effective
-// "no-op" as all of the gems that it requires should already be copied into
-// the layer. The launch layer installation process will however perform a
-// "bundle clean" to remove any extra gems, including those from the
-// "development" and "test" groups that may have been copied from the build
-// layer.
+// launch phases, Build will transfer the contents of the build layer into the
+// launch layer before executing the launch layer installation process, as
+// described by TransferGems, and report the time taken separately. Only the
+// gems that the Gemfile and lockfile select for the launch groups are
+// transferred. This will result in the launch layer installation process
+// performing an effective "no-op" as all of the gems that it requires should
+// already be in the layer. The launch layer installation process will however
+// perform a "bundle clean" to remove any extra gems that may have been
+// transferred from the build layer.
+//
+// When the build and launch groups select the same gems, the launch layer
+// installation process is not executed at all. Instead, the transferred gems
+// are shared with the launch layer, which is only given its Bundler
+// configuration.
+//
+// If the location of the Gemfile is configured, either through
+// $BP_BUNDLE_GEMFILE or BUNDLE_GEMFILE in the local Bundler configuration,
+// Build will install gems for that Gemfile and export its location as
+// BUNDLE_GEMFILE in each layer's environment so that "bundle exec" uses the
+// same Gemfile.
+//
+// Before installing, Build checks that the PLATFORMS section of the lockfile
+// lists the platform of the target architecture, such as "aarch64-linux". If
+// it does not, Build warns that Bundler will need to resolve the Gemfile again
+// and explains how to add the platform to the lockfile. With
+// $BP_BUNDLE_FORCE_RUBY_PLATFORM set, Build instead configures Bundler to
+// install the generic "ruby" platform variant of every gem, compiling native
+// extensions from source where no precompiled variant is available.
+//
+// If the application has no lockfile, Build lets Bundler resolve the Gemfile
+// and saves the lockfile it generates in each installed layer so that it can
+// be committed. With $BP_BUNDLE_REQUIRE_LOCKFILE set, Build instead fails.
+//
+// With $BP_BUNDLE_FROZEN set, Build configures Bundler in frozen deployment
+// mode for both layers, so that the lockfile is never changed. Before
+// installing, Build then fails with a diff of the differences if the gems
+// declared in the Gemfile do not match the DEPENDENCIES section of the
+// lockfile, or if the lockfile does not exist or lacks the target platform.
+//
+// Both layers are installed with Bundler's download cache, holding the .gem
+// files and compact index, in a cache-only "gem-cache" layer, so that gems are
+// only downloaded again when their versions change. After installing, the
+// .gem files that are no longer in the lockfile are pruned from this cache.
+// Bundler's bare clones of git sources are kept in a separate cache-only
+// "git-cache" layer, and Build checks that they contain the revisions locked
+// for the GIT sources before installing, so that only new revisions are
+// fetched.
 //
 // Finally, upon completing the installation process, Build will remove any
 // local bundler configuration files such that the Bundler CLI will only follow
@@ -73,6 +162,9 @@ func Build(
 	entries EntryResolver,
 	installProcess InstallProcess,
 	sbomGenerator SBOMGenerator,
+	lockfileParser LockfileParser,
+	gemfileParser GemfileDependencyParser,
+	gitCache GitCache,
 	logger scribe.Emitter,
 	clock chronos.Clock,
 	environment Environment,
@@ -82,8 +174,98 @@ func Build(
 
 		launch, build := entries.MergeLayerTypes("gems", context.Plan.Entries)
 
+		manifest, err := LocateManifest(context.WorkingDir, environment.Gemfile, environment.BundleGemfile)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		lockfileName := filepath.Base(manifest.Lockfile)
+		if !manifest.Locked {
+			if environment.Frozen {
+				return packit.BuildResult{}, fmt.Errorf("failed to install gems in frozen mode: %s does not exist, run `bundle lock` and commit the %s", lockfileName, lockfileName)
+			}
+
+			if environment.RequireLockfile {
+				return packit.BuildResult{}, fmt.Errorf("failed to install gems: %s does not exist and $BP_BUNDLE_REQUIRE_LOCKFILE is set, run `bundle lock` and commit the %s", lockfileName, lockfileName)
+			}
+		}
+
+		lock, err := lockfileParser.Parse(manifest.Lockfile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return packit.BuildResult{}, err
+		}
+
+		if environment.Frozen {
+			dependencies, err := gemfileParser.ParseDependencies(manifest.Gemfile)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			drift := CompareDependencies(dependencies, lock.Dependencies)
+			if !drift.Empty() {
+				return packit.BuildResult{}, fmt.Errorf("failed to install gems in frozen mode: the dependencies in %s do not match the DEPENDENCIES in %s, run `bundle install` and commit the %s:\n%s", filepath.Base(manifest.Gemfile), lockfileName, lockfileName, drift)
+			}
+		}
+
+		var forceRubyPlatform bool
+		platform := targetPlatform(context.TargetInfo)
+		if len(lock.Platforms) > 0 && !lock.SupportsPlatform(platform) {
+			if environment.Frozen {
+				return packit.BuildResult{}, fmt.Errorf("failed to install gems in frozen mode: %s does not list the %s platform of the build target (PLATFORMS: %s), run `bundle lock --add-platform %s` and commit the %s", lockfileName, platform, strings.Join(lock.Platforms, ", "), platform, lockfileName)
+			}
+
+			logger.Process("WARNING: %s does not list the %s platform of the build target (PLATFORMS: %s)", lockfileName, platform, strings.Join(lock.Platforms, ", "))
+			logger.Subprocess("Run `bundle lock --add-platform %s` and commit the updated %s", platform, lockfileName)
+
+			if environment.ForceRubyPlatform {
+				logger.Subprocess("Forcing the ruby platform as $BP_BUNDLE_FORCE_RUBY_PLATFORM is set, native extensions will be compiled from source")
+				forceRubyPlatform = true
+			} else {
+				logger.Subprocess("Alternatively, set $BP_BUNDLE_FORCE_RUBY_PLATFORM=true to install the ruby platform variant of each gem")
+			}
+			logger.Break()
+		}
+
+		buildGroups := MergeGemGroups(environment.BuildGroups, "build", context.Plan.Entries)
+		launchGroups := MergeGemGroups(environment.LaunchGroups, "launch", context.Plan.Entries)
+
+		target := newBuildTarget(context)
+
 		var layers []packit.Layer
 
+		var cacheLayer, gitLayer packit.Layer
+		if build || launch {
+			logger.Debug.Process("Getting the layer associated with %s", LayerNameGemCache)
+			cacheLayer, err = context.Layers.Get(LayerNameGemCache)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			logger.Debug.Subprocess(cacheLayer.Path)
+			logger.Debug.Break()
+
+			cacheLayer.Cache = true
+
+			logger.Debug.Process("Getting the layer associated with %s", LayerNameGitCache)
+			gitLayer, err = context.Layers.Get(LayerNameGitCache)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			logger.Debug.Subprocess(gitLayer.Path)
+			logger.Debug.Break()
+
+			gitLayer.Cache = true
+
+			err = linkGitCache(cacheLayer.Path, gitLayer.Path)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			err = gitCache.Verify(gitLayer.Path, lock)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
 		if build {
 			logger.Debug.Process("Getting the layer associated with %s", LayerNameBuildGems)
 			layer, err := context.Layers.Get(LayerNameBuildGems)
@@ -96,34 +278,91 @@ func Build(
 			layer.Build = true
 			layer.Cache = true
 
+			config := buildGroups.Config()
+			config["path"] = layer.Path
+			config["clean"] = "true"
+			if manifest.Configured {
+				config["gemfile"] = manifest.Gemfile
+			}
+			if forceRubyPlatform {
+				config["force_ruby_platform"] = "true"
+			}
+			if environment.Frozen {
+				config["deployment"] = "true"
+				config["frozen"] = "true"
+			}
+
+			settings := InstallSettings{
+				Config:         config,
+				KeepBuildFiles: environment.KeepGemExtensionBuildFiles,
+				Environment:    environment.BundleEnvironment,
+
+				RebuildOnRubyPatch: environment.RebuildOnRubyPatch,
+			}
+
 			logger.Debug.Process("Checking if the build environment install process should run")
 			logger.Debug.Break()
-			should, checksum, rubyVersion, err := installProcess.ShouldRun(layer.Metadata, context.WorkingDir)
+			reasons, key, abi, err := installProcess.ShouldRun(layer.Metadata, context.WorkingDir, manifest, settings)
 			if err != nil {
 				return packit.BuildResult{}, err
 			}
 
 			stack, ok := layer.Metadata["stack"]
 			if ok && stack.(string) != context.Stack {
-				logger.Process("Stack upgraded from %s to %s, clearing cached gems", stack.(string), context.Stack)
-				layer, err = layer.Reset()
+				layer, err = resetLayer(layer, logger, "Stack upgraded from %s to %s, clearing cached gems", stack.(string), context.Stack)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+
+				reasons = append(reasons, fmt.Sprintf("stack changed from %s to %s", stack.(string), context.Stack))
+			}
+
+			cachedTarget, ok := buildTargetFrom(layer.Metadata["target"])
+			if ok && cachedTarget != target {
+				layer, err = resetLayer(layer, logger, "Build target changed from %s to %s, clearing cached gems", cachedTarget, target)
 				if err != nil {
 					return packit.BuildResult{}, err
 				}
 
-				should = true
-				layer.Build = true
-				layer.Cache = true
+				reasons = append(reasons, fmt.Sprintf("build target changed from %s to %s", cachedTarget, target))
 			}
 
-			if should {
+			if environment.ForceInstall {
+				layer, err = resetLayer(layer, logger, "Clearing cached gems, as requested by the user")
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+
+				reasons = append(reasons, "clean install requested by the user")
+			}
+
+			groups, ok := layer.Metadata["groups"]
+			if ok && groups.(string) != buildGroups.String() {
+				reasons = append(reasons, fmt.Sprintf("gem groups changed from %s to %s", groups.(string), buildGroups))
+			}
+
+			stale, err := PruneStaleGems(layer.Path, abi)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			if len(stale.Roots) > 0 {
+				logger.Process("Removed gems installed for other Ruby ABIs, reclaiming %s", formatSize(stale.Size))
+				for _, root := range stale.Roots {
+					logger.Subprocess(root)
+				}
+				logger.Break()
+			}
+
+			if len(reasons) > 0 {
 				logger.Process("Executing build environment install process")
+				logger.Subprocess("Installing because:")
+				for _, reason := range reasons {
+					logger.Action(reason)
+				}
 
 				duration, err := clock.Measure(func() error {
-					return installProcess.Execute(context.WorkingDir, layer.Path, map[string]string{
-						"path":  layer.Path,
-						"clean": "true",
-					}, environment.KeepGemExtensionBuildFiles)
+					return installProcess.Execute(context.WorkingDir, layer.Path, cacheLayer.Path, config, environment.KeepGemExtensionBuildFiles)
 				})
 				if err != nil {
 					return packit.BuildResult{}, err
@@ -132,11 +371,25 @@ func Build(
 				logger.Action("Completed in %s", duration.Round(time.Millisecond))
 				logger.Break()
 
+				if !manifest.Locked {
+					err = saveGeneratedLockfile(manifest.Lockfile, layer.Path, logger)
+					if err != nil {
+						return packit.BuildResult{}, err
+					}
+				}
+
 				layer.BuildEnv.Default("BUNDLE_USER_CONFIG", filepath.Join(layer.Path, "config"))
+				if manifest.Configured {
+					layer.BuildEnv.Default("BUNDLE_GEMFILE", manifest.Gemfile)
+				}
 				layer.Metadata = map[string]interface{}{
-					"stack":        context.Stack,
-					"cache_sha":    checksum,
-					"ruby_version": rubyVersion,
+					"stack":           context.Stack,
+					"cache_key":       key.Metadata(),
+					"ruby_version":    abi.Version,
+					"ruby_abi":        abi.Metadata(),
+					"groups":          buildGroups.String(),
+					"install_reasons": reasons,
+					"target":          target.metadata(),
 				}
 
 				logger.GeneratingSBOM(layer.Path)
@@ -177,46 +430,105 @@ func Build(
 
 			layer.Launch = true
 
+			config := launchGroups.Config()
+			config["path"] = layer.Path
+			config["clean"] = "true"
+			if manifest.Configured {
+				config["gemfile"] = manifest.Gemfile
+			}
+			if forceRubyPlatform {
+				config["force_ruby_platform"] = "true"
+			}
+			if environment.Frozen {
+				config["deployment"] = "true"
+				config["frozen"] = "true"
+			}
+
+			settings := InstallSettings{
+				Config:         config,
+				KeepBuildFiles: environment.KeepGemExtensionBuildFiles,
+				Environment:    environment.BundleEnvironment,
+
+				RebuildOnRubyPatch: environment.RebuildOnRubyPatch,
+			}
+
 			logger.Debug.Process("Checking if the launch environment install process should run")
 			logger.Debug.Break()
-			should, checksum, rubyVersion, err := installProcess.ShouldRun(layer.Metadata, context.WorkingDir)
+			reasons, key, abi, err := installProcess.ShouldRun(layer.Metadata, context.WorkingDir, manifest, settings)
 			if err != nil {
 				return packit.BuildResult{}, err
 			}
 
 			stack, ok := layer.Metadata["stack"]
 			if ok && stack.(string) != context.Stack {
-				logger.Process("Stack upgraded from %s to %s, clearing cached gems", stack.(string), context.Stack)
-				layer, err = layer.Reset()
+				layer, err = resetLayer(layer, logger, "Stack upgraded from %s to %s, clearing cached gems", stack.(string), context.Stack)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+
+				reasons = append(reasons, fmt.Sprintf("stack changed from %s to %s", stack.(string), context.Stack))
+			}
+
+			cachedTarget, ok := buildTargetFrom(layer.Metadata["target"])
+			if ok && cachedTarget != target {
+				layer, err = resetLayer(layer, logger, "Build target changed from %s to %s, clearing cached gems", cachedTarget, target)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+
+				reasons = append(reasons, fmt.Sprintf("build target changed from %s to %s", cachedTarget, target))
+			}
+
+			if environment.ForceInstall {
+				layer, err = resetLayer(layer, logger, "Clearing cached gems, as requested by the user")
 				if err != nil {
 					return packit.BuildResult{}, err
 				}
-				should = true
-				layer.Launch = true
+
+				reasons = append(reasons, "clean install requested by the user")
+			}
+
+			groups, ok := layer.Metadata["groups"]
+			if ok && groups.(string) != launchGroups.String() {
+				reasons = append(reasons, fmt.Sprintf("gem groups changed from %s to %s", groups.(string), launchGroups))
 			}
 
-			if should {
+			if len(reasons) > 0 {
 				logger.Process("Executing launch environment install process")
+				logger.Subprocess("Installing because:")
+				for _, reason := range reasons {
+					logger.Action(reason)
+				}
 
-				duration, err := clock.Measure(func() error {
+				var shared bool
+				if build {
+					var names []string
+					names, shared, err = launchGems(gemfileParser, manifest, lock, buildGroups, launchGroups)
+					if err != nil {
+						return packit.BuildResult{}, err
+					}
+
+					err = transferBuildGems(context, layer.Path, names, clock, logger)
+					if err != nil {
+						return packit.BuildResult{}, err
+					}
+				}
+
+				var duration time.Duration
+				if shared {
+					logger.Subprocess("Sharing the build environment install, as it holds the same gems")
+					duration, err = clock.Measure(func() error {
+						return installProcess.Configure(context.WorkingDir, layer.Path, config)
+					})
+				} else {
 					if build {
-						buildLayer, err := context.Layers.Get(LayerNameBuildGems)
-						if err != nil {
-							return err
-						}
-
-						err = fs.Copy(filepath.Join(buildLayer.Path), filepath.Join(layer.Path))
-						if err != nil {
-							return err
-						}
+						logger.Subprocess("Installing launch gems")
 					}
 
-					return installProcess.Execute(context.WorkingDir, layer.Path, map[string]string{
-						"path":    layer.Path,
-						"without": "development:test",
-						"clean":   "true",
-					}, environment.KeepGemExtensionBuildFiles)
-				})
+					duration, err = clock.Measure(func() error {
+						return installProcess.Execute(context.WorkingDir, layer.Path, cacheLayer.Path, config, environment.KeepGemExtensionBuildFiles)
+					})
+				}
 				if err != nil {
 					return packit.BuildResult{}, err
 				}
@@ -224,11 +536,25 @@ func Build(
 				logger.Action("Completed in %s", duration.Round(time.Millisecond))
 				logger.Break()
 
+				if !manifest.Locked {
+					err = saveGeneratedLockfile(manifest.Lockfile, layer.Path, logger)
+					if err != nil {
+						return packit.BuildResult{}, err
+					}
+				}
+
 				layer.LaunchEnv.Default("BUNDLE_USER_CONFIG", filepath.Join(layer.Path, "config"))
+				if manifest.Configured {
+					layer.LaunchEnv.Default("BUNDLE_GEMFILE", manifest.Gemfile)
+				}
 				layer.Metadata = map[string]interface{}{
-					"stack":        context.Stack,
-					"cache_sha":    checksum,
-					"ruby_version": rubyVersion,
+					"stack":           context.Stack,
+					"cache_key":       key.Metadata(),
+					"ruby_version":    abi.Version,
+					"ruby_abi":        abi.Metadata(),
+					"groups":          launchGroups.String(),
+					"install_reasons": reasons,
+					"target":          target.metadata(),
 				}
 
 				logger.GeneratingSBOM(layer.Path)
@@ -257,12 +583,37 @@ func Build(
 			layers = append(layers, layer)
 		}
 
+		if build || launch {
+			// without a lockfile, the gems are pruned against the one that
+			// Bundler generated, if any
+			if !manifest.Locked {
+				lock, err = lockfileParser.Parse(manifest.Lockfile)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					return packit.BuildResult{}, err
+				}
+			}
+
+			if len(lock.Specs()) > 0 {
+				removed, err := PruneGemCache(cacheLayer.Path, lock)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+
+				if len(removed) > 0 {
+					logger.Process("Pruned %d gem(s) not in %s from the download cache", len(removed), lockfileName)
+					logger.Break()
+				}
+			}
+
+			layers = append(layers, cacheLayer, gitLayer)
+		}
+
 		for _, layer := range layers {
 			logger.EnvironmentVariables(layer)
 		}
 
 		logger.Debug.Process("Cleaning up %s/.bundle/config", context.WorkingDir)
-		err := os.RemoveAll(filepath.Join(context.WorkingDir, ".bundle", "config"))
+		err = os.RemoveAll(filepath.Join(context.WorkingDir, ".bundle", "config"))
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
@@ -277,3 +628,184 @@ func Build(
 		return packit.BuildResult{Layers: layers}, nil
 	}
 }
+
+// launchGems returns the names of the gems that the Gemfile and lockfile
+// select for the launch groups, or nil when they cannot be determined. It also
+// returns true when the build groups select the same gems, in which case the
+// gems of the build layer need not be installed again for launch.
+func launchGems(gemfileParser GemfileDependencyParser, manifest Manifest, lock lockfile.Lockfile, buildGroups, launchGroups GemGroups) ([]string, bool, error) {
+	gemfileGroups, err := gemfileParser.ParseGroups(manifest.Gemfile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	names, ok := SelectGems(lock, gemfileGroups, launchGroups)
+	if !ok {
+		return nil, false, nil
+	}
+
+	buildNames, _ := SelectGems(lock, gemfileGroups, buildGroups)
+
+	return names, slices.Equal(names, buildNames), nil
+}
+
+// transferBuildGems transfers the gems of the build layer into the launch
+// layer at the given path, other than those that are not among the given gem
+// names, and reports how they were transferred. Every gem is transferred when
+// the gem names are nil.
+func transferBuildGems(context packit.BuildContext, layerPath string, names []string, clock chronos.Clock, logger scribe.Emitter) error {
+	buildLayer, err := context.Layers.Get(LayerNameBuildGems)
+	if err != nil {
+		return err
+	}
+
+	logger.Subprocess("Transferring gems from the build layer")
+
+	var transfer GemTransfer
+	duration, err := clock.Measure(func() error {
+		transfer, err = TransferGems(buildLayer.Path, layerPath, names)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Action("Reflinked %d, hardlinked %d and copied %d files", transfer.Reflinked, transfer.Hardlinked, transfer.Copied)
+	if len(transfer.Skipped) > 0 {
+		logger.Action("Skipped %d gem(s) outside of the launch groups", len(transfer.Skipped))
+	}
+	logger.Action("Completed in %s", duration.Round(time.Millisecond))
+
+	return nil
+}
+
+// resetLayer clears the cached gems of the given layer, logging the given
+// message, and keeps the build, launch and cache flags of the layer, which
+// resetting would otherwise clear.
+func resetLayer(layer packit.Layer, logger scribe.Emitter, format string, v ...interface{}) (packit.Layer, error) {
+	logger.Process(format, v...)
+
+	build, launch, cache := layer.Build, layer.Launch, layer.Cache
+	layer, err := layer.Reset()
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	layer.Build, layer.Launch, layer.Cache = build, launch, cache
+
+	return layer, nil
+}
+
+// saveGeneratedLockfile copies the lockfile that Bundler generated for an
+// application without one into the layer, so that it can be retrieved and
+// committed.
+func saveGeneratedLockfile(lockfile, layerPath string, logger scribe.Emitter) error {
+	exists, err := fs.Exists(lockfile)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return nil
+	}
+
+	destination := filepath.Join(layerPath, filepath.Base(lockfile))
+	err = fs.Copy(lockfile, destination)
+	if err != nil {
+		return fmt.Errorf("failed to save the generated %s: %w", filepath.Base(lockfile), err)
+	}
+
+	logger.Process("Saved the %s generated by Bundler to %s", filepath.Base(lockfile), destination)
+	logger.Subprocess("Commit it with the application to install the same gem versions in every build")
+	logger.Break()
+
+	return nil
+}
+
+// targetPlatform returns the RubyGems platform, such as "x86_64-linux", of the
+// build target.
+func targetPlatform(target packit.TargetInfo) string {
+	os, arch := target.OS, target.Arch
+	if os == "" {
+		os = "linux"
+	}
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+
+	switch arch {
+	case "amd64":
+		arch = "x86_64"
+	case "arm64":
+		arch = "aarch64"
+	}
+
+	return fmt.Sprintf("%s-%s", arch, os)
+}
+
+// buildTarget is the target of the build that is recorded in the layer
+// metadata, as gems with native extensions only work on the target they were
+// compiled for.
+type buildTarget struct {
+	OS            string
+	Arch          string
+	DistroName    string
+	DistroVersion string
+}
+
+func newBuildTarget(context packit.BuildContext) buildTarget {
+	return buildTarget{
+		OS:            context.TargetInfo.OS,
+		Arch:          context.TargetInfo.Arch,
+		DistroName:    context.TargetDistro.Name,
+		DistroVersion: context.TargetDistro.Version,
+	}
+}
+
+// buildTargetFrom returns the build target recorded in the given layer
+// metadata, if any.
+func buildTargetFrom(metadata interface{}) (buildTarget, bool) {
+	target, ok := metadata.(map[string]interface{})
+	if !ok {
+		return buildTarget{}, false
+	}
+
+	value := func(key string) string {
+		s, _ := target[key].(string)
+		return s
+	}
+
+	return buildTarget{
+		OS:            value("os"),
+		Arch:          value("arch"),
+		DistroName:    value("distro_name"),
+		DistroVersion: value("distro_version"),
+	}, true
+}
+
+func (t buildTarget) metadata() map[string]interface{} {
+	return map[string]interface{}{
+		"os":             t.OS,
+		"arch":           t.Arch,
+		"distro_name":    t.DistroName,
+		"distro_version": t.DistroVersion,
+	}
+}
+
+func (t buildTarget) String() string {
+	description := strings.Trim(fmt.Sprintf("%s/%s", t.OS, t.Arch), "/")
+	if description == "" {
+		description = "unknown"
+	}
+
+	distro := strings.TrimSpace(fmt.Sprintf("%s %s", t.DistroName, t.DistroVersion))
+	if distro != "" {
+		description = fmt.Sprintf("%s (%s)", description, distro)
+	}
+
+	return description
+}
@@ -13,6 +13,7 @@ import (
 
 	bundleinstall "github.com/paketo-buildpacks/bundle-install"
 	"github.com/paketo-buildpacks/bundle-install/fakes"
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/sbom"
@@ -121,6 +122,9 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		installProcess *fakes.InstallProcess
 		entryResolver  *fakes.EntryResolver
 		sbomGenerator  *fakes.SBOMGenerator
+		lockfileParser *fakes.LockfileParser
+		gemfileParser  *fakes.GemfileDependencyParser
+		gitCache       *fakes.GitCache
 
 		build        packit.BuildFunc
 		buildContext packit.BuildContext
@@ -139,9 +143,14 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config.bak"), nil, 0600)).To(Succeed())
 
 		installProcess = &fakes.InstallProcess{}
-		installProcess.ShouldRunCall.Returns.Should = true
-		installProcess.ShouldRunCall.Returns.Checksum = "some-checksum"
-		installProcess.ShouldRunCall.Returns.RubyVersion = "some-version"
+		installProcess.ShouldRunCall.Returns.Reasons = []string{"no previous metadata"}
+		installProcess.ShouldRunCall.Returns.Key = bundleinstall.CacheKey{Gemfile: "some-checksum"}
+		installProcess.ShouldRunCall.Returns.RubyABI = bundleinstall.RubyABI{
+			Version:    "some-version",
+			ABIVersion: "some-abi-version",
+			Platform:   "some-platform",
+			Engine:     "ruby",
+		}
 
 		sbomGenerator = &fakes.SBOMGenerator{}
 		sbomGenerator.GenerateCall.Returns.SBOM = sbom.SBOM{}
@@ -150,14 +159,22 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		clock = chronos.DefaultClock
 
 		entryResolver = &fakes.EntryResolver{}
+		lockfileParser = &fakes.LockfileParser{}
+		gemfileParser = &fakes.GemfileDependencyParser{}
+		gitCache = &fakes.GitCache{}
 
 		build = bundleinstall.Build(
 			entryResolver,
 			installProcess,
 			sbomGenerator,
+			lockfileParser,
+			gemfileParser,
+			gitCache,
 			scribe.NewEmitter(buffer),
 			clock,
-			bundleinstall.Environment{},
+			bundleinstall.Environment{
+				LaunchGroups: bundleinstall.GemGroups{Without: []string{"development", "test"}},
+			},
 		)
 
 		buildContext = packit.BuildContext{
@@ -195,7 +212,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(err).NotTo(HaveOccurred())
 
 			layers := result.Layers
-			Expect(layers).To(HaveLen(1))
+			Expect(layers).To(HaveLen(3))
 
 			layer := layers[0]
 			Expect(layer.Name).To(Equal("build-gems"))
@@ -213,9 +230,32 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(layer.SharedEnv).To(BeEmpty())
 
 			Expect(layer.Metadata).To(Equal(map[string]interface{}{
-				"stack":        "",
-				"cache_sha":    "some-checksum",
+				"stack": "",
+				"cache_key": map[string]interface{}{
+					"gemfile":            "some-checksum",
+					"lockfile":           "",
+					"bundle_config":      "",
+					"vendored_gems":      "",
+					"bundle_environment": "",
+					"buildpack_config":   "",
+				},
 				"ruby_version": "some-version",
+				"ruby_abi": map[string]interface{}{
+					"abi_version": "some-abi-version",
+					"platform":    "some-platform",
+					"engine":      "ruby",
+					"shared":      "",
+					"libs":        "",
+					"yjit":        "",
+				},
+				"groups":          "without=;with=;only=",
+				"install_reasons": []string{"no previous metadata"},
+				"target": map[string]interface{}{
+					"os":             "",
+					"arch":           "",
+					"distro_name":    "",
+					"distro_version": "",
+				},
 			}))
 
 			Expect(layer.SBOM.Formats()).To(HaveLen(2))
@@ -242,9 +282,43 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 
 			Expect(installProcess.ShouldRunCall.Receives.Metadata).To(BeNil())
 			Expect(installProcess.ShouldRunCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(installProcess.ShouldRunCall.Receives.Manifest).To(Equal(bundleinstall.Manifest{
+				Gemfile:  filepath.Join(workingDir, "Gemfile"),
+				Lockfile: filepath.Join(workingDir, "Gemfile.lock"),
+			}))
+			Expect(installProcess.ShouldRunCall.Receives.Settings).To(Equal(bundleinstall.InstallSettings{
+				Config: map[string]string{
+					"path":  filepath.Join(layersDir, "build-gems"),
+					"clean": "true",
+				},
+			}))
+
+			cacheLayer := layers[1]
+			Expect(cacheLayer.Name).To(Equal("gem-cache"))
+			Expect(cacheLayer.Path).To(Equal(filepath.Join(layersDir, "gem-cache")))
+
+			Expect(cacheLayer.Build).To(BeFalse())
+			Expect(cacheLayer.Launch).To(BeFalse())
+			Expect(cacheLayer.Cache).To(BeTrue())
+
+			gitLayer := layers[2]
+			Expect(gitLayer.Name).To(Equal("git-cache"))
+			Expect(gitLayer.Path).To(Equal(filepath.Join(layersDir, "git-cache")))
+
+			Expect(gitLayer.Build).To(BeFalse())
+			Expect(gitLayer.Launch).To(BeFalse())
+			Expect(gitLayer.Cache).To(BeTrue())
+
+			link, err := os.Readlink(filepath.Join(layersDir, "gem-cache", "git"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link).To(Equal(filepath.Join(layersDir, "git-cache")))
+
+			Expect(gitCache.VerifyCall.CallCount).To(Equal(1))
+			Expect(gitCache.VerifyCall.Receives.Path).To(Equal(filepath.Join(layersDir, "git-cache")))
 
 			Expect(installProcess.ExecuteCall.CallCount).To(Equal(1))
 			Expect(installProcess.ExecuteCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(installProcess.ExecuteCall.Receives.DownloadCachePath).To(Equal(filepath.Join(layersDir, "gem-cache")))
 			Expect(installProcess.ExecuteCall.Receives.Config).To(Equal(map[string]string{
 				"path":  filepath.Join(layersDir, "build-gems"),
 				"clean": "true",
@@ -256,6 +330,8 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(buffer).To(ContainLines(
 				"Some Buildpack some-version",
 				"  Executing build environment install process",
+				"    Installing because:",
+				"      no previous metadata",
 				"      Completed in 0s",
 			))
 			Expect(buffer).To(ContainLines(
@@ -270,10 +346,14 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					entryResolver,
 					installProcess,
 					sbomGenerator,
+					lockfileParser,
+					gemfileParser,
+					gitCache,
 					scribe.NewEmitter(buffer),
 					clock,
 					bundleinstall.Environment{
 						KeepGemExtensionBuildFiles: true,
+						LaunchGroups:               bundleinstall.GemGroups{Without: []string{"development", "test"}},
 					},
 				)
 			})
@@ -289,6 +369,118 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					"clean": "true",
 				}))
 				Expect(installProcess.ExecuteCall.Receives.KeepBuildFiles).To(BeTrue())
+				Expect(installProcess.ShouldRunCall.Receives.Settings.KeepBuildFiles).To(BeTrue())
+			})
+		})
+
+		context("when BUNDLE_* environment variables are set", func() {
+			it.Before(func() {
+				build = bundleinstall.Build(
+					entryResolver,
+					installProcess,
+					sbomGenerator,
+					lockfileParser,
+					gemfileParser,
+					gitCache,
+					scribe.NewEmitter(buffer),
+					clock,
+					bundleinstall.Environment{
+						LaunchGroups:      bundleinstall.GemGroups{Without: []string{"development", "test"}},
+						BundleEnvironment: []string{"BUNDLE_JOBS=4"},
+					},
+				)
+			})
+
+			it("includes them in the cache key", func() {
+				_, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(installProcess.ShouldRunCall.Receives.Settings.Environment).To(Equal([]string{"BUNDLE_JOBS=4"}))
+			})
+		})
+
+		context("when the user asks to rebuild on every Ruby patch release", func() {
+			it.Before(func() {
+				build = bundleinstall.Build(
+					entryResolver,
+					installProcess,
+					sbomGenerator,
+					lockfileParser,
+					gemfileParser,
+					gitCache,
+					scribe.NewEmitter(buffer),
+					clock,
+					bundleinstall.Environment{
+						LaunchGroups:       bundleinstall.GemGroups{Without: []string{"development", "test"}},
+						RebuildOnRubyPatch: true,
+					},
+				)
+			})
+
+			it("informs the install process", func() {
+				_, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(installProcess.ShouldRunCall.Receives.Settings.RebuildOnRubyPatch).To(BeTrue())
+			})
+		})
+
+		context("when a requirer asks for gem groups", func() {
+			it.Before(func() {
+				buildContext.Plan.Entries[0].Metadata["groups"] = []interface{}{"assets"}
+			})
+
+			it("installs those groups", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(installProcess.ExecuteCall.Receives.Config).To(Equal(map[string]string{
+					"path":  filepath.Join(layersDir, "build-gems"),
+					"with":  "assets",
+					"clean": "true",
+				}))
+				Expect(result.Layers[0].Metadata).To(HaveKeyWithValue("groups", "without=;with=assets;only="))
+			})
+		})
+
+		context("when the Gemfile location is configured", func() {
+			it.Before(func() {
+				build = bundleinstall.Build(
+					entryResolver,
+					installProcess,
+					sbomGenerator,
+					lockfileParser,
+					gemfileParser,
+					gitCache,
+					scribe.NewEmitter(buffer),
+					clock,
+					bundleinstall.Environment{
+						Gemfile:      "Gemfile.next",
+						LaunchGroups: bundleinstall.GemGroups{Without: []string{"development", "test"}},
+					},
+				)
+			})
+
+			it("installs gems for that Gemfile and exports its location", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(installProcess.ShouldRunCall.Receives.Manifest).To(Equal(bundleinstall.Manifest{
+					Gemfile:    filepath.Join(workingDir, "Gemfile.next"),
+					Lockfile:   filepath.Join(workingDir, "Gemfile.next.lock"),
+					Configured: true,
+				}))
+
+				Expect(installProcess.ExecuteCall.Receives.Config).To(Equal(map[string]string{
+					"path":    filepath.Join(layersDir, "build-gems"),
+					"clean":   "true",
+					"gemfile": filepath.Join(workingDir, "Gemfile.next"),
+				}))
+
+				Expect(result.Layers[0].BuildEnv).To(Equal(packit.Environment{
+					"BUNDLE_USER_CONFIG.default": filepath.Join(layersDir, "build-gems", "config"),
+					"BUNDLE_GEMFILE.default":     filepath.Join(workingDir, "Gemfile.next"),
+				}))
 			})
 		})
 	})
@@ -311,7 +503,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(err).NotTo(HaveOccurred())
 
 			layers := result.Layers
-			Expect(layers).To(HaveLen(1))
+			Expect(layers).To(HaveLen(3))
 
 			layer := layers[0]
 			Expect(layer.Name).To(Equal("launch-gems"))
@@ -329,9 +521,32 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(layer.SharedEnv).To(BeEmpty())
 
 			Expect(layer.Metadata).To(Equal(map[string]interface{}{
-				"stack":        "",
-				"cache_sha":    "some-checksum",
+				"stack": "",
+				"cache_key": map[string]interface{}{
+					"gemfile":            "some-checksum",
+					"lockfile":           "",
+					"bundle_config":      "",
+					"vendored_gems":      "",
+					"bundle_environment": "",
+					"buildpack_config":   "",
+				},
 				"ruby_version": "some-version",
+				"ruby_abi": map[string]interface{}{
+					"abi_version": "some-abi-version",
+					"platform":    "some-platform",
+					"engine":      "ruby",
+					"shared":      "",
+					"libs":        "",
+					"yjit":        "",
+				},
+				"groups":          "without=development:test;with=;only=",
+				"install_reasons": []string{"no previous metadata"},
+				"target": map[string]interface{}{
+					"os":             "",
+					"arch":           "",
+					"distro_name":    "",
+					"distro_version": "",
+				},
 			}))
 
 			Expect(layer.SBOM.Formats()).To(HaveLen(2))
@@ -357,6 +572,10 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 
 			Expect(installProcess.ShouldRunCall.Receives.Metadata).To(BeNil())
 			Expect(installProcess.ShouldRunCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(installProcess.ShouldRunCall.Receives.Manifest).To(Equal(bundleinstall.Manifest{
+				Gemfile:  filepath.Join(workingDir, "Gemfile"),
+				Lockfile: filepath.Join(workingDir, "Gemfile.lock"),
+			}))
 
 			Expect(installProcess.ExecuteCall.CallCount).To(Equal(1))
 			Expect(installProcess.ExecuteCall.Receives.WorkingDir).To(Equal(workingDir))
@@ -372,6 +591,8 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(buffer).To(ContainLines(
 				"Some Buildpack some-version",
 				"  Executing launch environment install process",
+				"    Installing because:",
+				"      no previous metadata",
 				"      Completed in 0s",
 			))
 			Expect(buffer).To(ContainLines(
@@ -386,10 +607,14 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					entryResolver,
 					installProcess,
 					sbomGenerator,
+					lockfileParser,
+					gemfileParser,
+					gitCache,
 					scribe.NewEmitter(buffer),
 					clock,
 					bundleinstall.Environment{
 						KeepGemExtensionBuildFiles: true,
+						LaunchGroups:               bundleinstall.GemGroups{Without: []string{"development", "test"}},
 					},
 				)
 			})
@@ -408,6 +633,41 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				Expect(installProcess.ExecuteCall.Receives.KeepBuildFiles).To(BeTrue())
 			})
 		})
+		context("when the Gemfile location is configured", func() {
+			it.Before(func() {
+				build = bundleinstall.Build(
+					entryResolver,
+					installProcess,
+					sbomGenerator,
+					lockfileParser,
+					gemfileParser,
+					gitCache,
+					scribe.NewEmitter(buffer),
+					clock,
+					bundleinstall.Environment{
+						Gemfile:      "Gemfile.next",
+						LaunchGroups: bundleinstall.GemGroups{Without: []string{"development", "test"}},
+					},
+				)
+			})
+
+			it("installs gems for that Gemfile and exports its location", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(installProcess.ExecuteCall.Receives.Config).To(Equal(map[string]string{
+					"path":    filepath.Join(layersDir, "launch-gems"),
+					"without": "development:test",
+					"clean":   "true",
+					"gemfile": filepath.Join(workingDir, "Gemfile.next"),
+				}))
+
+				Expect(result.Layers[0].LaunchEnv).To(Equal(packit.Environment{
+					"BUNDLE_USER_CONFIG.default": filepath.Join(layersDir, "launch-gems", "config"),
+					"BUNDLE_GEMFILE.default":     filepath.Join(workingDir, "Gemfile.next"),
+				}))
+			})
+		})
 	})
 
 	context("when not required during either build or launch", func() {
@@ -448,7 +708,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(err).NotTo(HaveOccurred())
 
 			layers := result.Layers
-			Expect(layers).To(HaveLen(2))
+			Expect(layers).To(HaveLen(4))
 
 			buildLayer := layers[0]
 			Expect(buildLayer.Name).To(Equal("build-gems"))
@@ -466,9 +726,32 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(buildLayer.SharedEnv).To(BeEmpty())
 
 			Expect(buildLayer.Metadata).To(Equal(map[string]interface{}{
-				"stack":        "",
-				"cache_sha":    "some-checksum",
+				"stack": "",
+				"cache_key": map[string]interface{}{
+					"gemfile":            "some-checksum",
+					"lockfile":           "",
+					"bundle_config":      "",
+					"vendored_gems":      "",
+					"bundle_environment": "",
+					"buildpack_config":   "",
+				},
 				"ruby_version": "some-version",
+				"ruby_abi": map[string]interface{}{
+					"abi_version": "some-abi-version",
+					"platform":    "some-platform",
+					"engine":      "ruby",
+					"shared":      "",
+					"libs":        "",
+					"yjit":        "",
+				},
+				"groups":          "without=;with=;only=",
+				"install_reasons": []string{"no previous metadata"},
+				"target": map[string]interface{}{
+					"os":             "",
+					"arch":           "",
+					"distro_name":    "",
+					"distro_version": "",
+				},
 			}))
 
 			Expect(buildLayer.SBOM.Formats()).To(HaveLen(2))
@@ -501,9 +784,32 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(launchLayer.SharedEnv).To(BeEmpty())
 
 			Expect(launchLayer.Metadata).To(Equal(map[string]interface{}{
-				"stack":        "",
-				"cache_sha":    "some-checksum",
+				"stack": "",
+				"cache_key": map[string]interface{}{
+					"gemfile":            "some-checksum",
+					"lockfile":           "",
+					"bundle_config":      "",
+					"vendored_gems":      "",
+					"bundle_environment": "",
+					"buildpack_config":   "",
+				},
 				"ruby_version": "some-version",
+				"ruby_abi": map[string]interface{}{
+					"abi_version": "some-abi-version",
+					"platform":    "some-platform",
+					"engine":      "ruby",
+					"shared":      "",
+					"libs":        "",
+					"yjit":        "",
+				},
+				"groups":          "without=development:test;with=;only=",
+				"install_reasons": []string{"no previous metadata"},
+				"target": map[string]interface{}{
+					"os":             "",
+					"arch":           "",
+					"distro_name":    "",
+					"distro_version": "",
+				},
 			}))
 
 			Expect(launchLayer.SBOM.Formats()).To(HaveLen(2))
@@ -526,167 +832,888 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
-	context("when reusing a layer", func() {
+	context("when the launch groups exclude gems installed in the build layer", func() {
 		it.Before(func() {
 			entryResolver.MergeLayerTypesCall.Returns.Build = true
 			entryResolver.MergeLayerTypesCall.Returns.Launch = true
 
-			installProcess.ShouldRunCall.Returns.Should = false
-
-			err := os.WriteFile(filepath.Join(layersDir, "build-gems.toml"), []byte(`
-build = true
-cache = true
-
-[metadata]
-  stack = ""
-	cache_sha = "some-checksum"
-	ruby_version = "some-version"
-`), 0600)
-			Expect(err).NotTo(HaveOccurred())
-
-			err = os.WriteFile(filepath.Join(layersDir, "launch-gems.toml"), []byte(`
-launch = true
+			gemfileParser.ParseGroupsCall.Returns.GemfileGroups = bundleinstall.GemfileGroups{
+				Groups: map[string][]string{
+					"rack":       {"default"},
+					"rspec-core": {"test"},
+				},
+			}
+			lockfileParser.ParseCall.Returns.Lockfile = lockfile.Lockfile{
+				Sources: []lockfile.Source{
+					{
+						Type:    lockfile.SourceTypeGem,
+						Remotes: []string{"https://rubygems.org/"},
+						Specs: []lockfile.Spec{
+							{Name: "rack", Version: "3.0.8"},
+							{Name: "rspec-core", Version: "3.13.0"},
+						},
+					},
+				},
+				Dependencies: []lockfile.Dependency{{Name: "rack"}, {Name: "rspec-core"}},
+			}
 
-[metadata]
-	stack = ""
-	cache_sha = "some-checksum"
-	ruby_version = "some-version"
-`), 0600)
-			Expect(err).NotTo(HaveOccurred())
+			for _, name := range []string{"rack-3.0.8", "rspec-core-3.13.0"} {
+				Expect(os.MkdirAll(filepath.Join(layersDir, "build-gems", "ruby", "some-abi-version", "gems", name), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layersDir, "build-gems", "ruby", "some-abi-version", "gems", name, "lib.rb"), nil, 0600)).To(Succeed())
+			}
 		})
 
-		it("returns a result that reuses the existing layer", func() {
-			result, err := build(buildContext)
+		it("transfers only the launch gems and reports the transfer separately", func() {
+			_, err := build(buildContext)
 			Expect(err).NotTo(HaveOccurred())
 
-			layers := result.Layers
-			Expect(layers).To(HaveLen(2))
-
-			buildLayer := layers[0]
-			Expect(buildLayer.Name).To(Equal("build-gems"))
-			Expect(buildLayer.Path).To(Equal(filepath.Join(layersDir, "build-gems")))
-
-			Expect(buildLayer.Build).To(BeTrue())
-			Expect(buildLayer.Launch).To(BeFalse())
-			Expect(buildLayer.Cache).To(BeTrue())
-
-			launchLayer := layers[1]
-			Expect(launchLayer.Name).To(Equal("launch-gems"))
-			Expect(launchLayer.Path).To(Equal(filepath.Join(layersDir, "launch-gems")))
-
-			Expect(launchLayer.Build).To(BeFalse())
-			Expect(launchLayer.Launch).To(BeTrue())
-			Expect(launchLayer.Cache).To(BeFalse())
-
-			Expect(filepath.Join(workingDir, ".bundle", "config")).NotTo(BeAnExistingFile())
-
-			Expect(installProcess.ShouldRunCall.Receives.Metadata).To(Equal(map[string]interface{}{
-				"stack":        "",
-				"cache_sha":    "some-checksum",
-				"ruby_version": "some-version",
-			}))
-			Expect(installProcess.ShouldRunCall.Receives.WorkingDir).To(Equal(workingDir))
+			gemsPath := filepath.Join(layersDir, "launch-gems", "ruby", "some-abi-version", "gems")
+			Expect(filepath.Join(gemsPath, "rack-3.0.8", "lib.rb")).To(BeAnExistingFile())
+			Expect(filepath.Join(gemsPath, "rspec-core-3.13.0")).NotTo(BeAnExistingFile())
 
-			Expect(installProcess.ExecuteCall.CallCount).To(Equal(0))
+			Expect(installProcess.ExecuteCall.CallCount).To(Equal(2))
+			Expect(installProcess.ConfigureCall.CallCount).To(Equal(0))
 
-			Expect(buffer.String()).To(ContainSubstring("Some Buildpack some-version"))
-			Expect(buffer.String()).To(ContainSubstring("Reusing cached layer"))
 			Expect(buffer).To(ContainLines(
-				"Some Buildpack some-version",
-				fmt.Sprintf("  Reusing cached layer %s", filepath.Join(layersDir, "build-gems")),
-				"",
-				fmt.Sprintf("  Reusing cached layer %s", filepath.Join(layersDir, "launch-gems")),
+				"  Executing launch environment install process",
+				"    Installing because:",
+				"      no previous metadata",
+				"    Transferring gems from the build layer",
+				MatchRegexp(`      Reflinked \d+, hardlinked \d+ and copied \d+ files`),
+				"      Skipped 1 gem(s) outside of the launch groups",
+				MatchRegexp(`      Completed in \d+m?s`),
+				"    Installing launch gems",
+				"      Completed in 0s",
 			))
 		})
 	})
 
-	context("when trying to reuse a layer but the stack changes", func() {
+	context("when the build and launch groups select the same gems", func() {
 		it.Before(func() {
 			entryResolver.MergeLayerTypesCall.Returns.Build = true
 			entryResolver.MergeLayerTypesCall.Returns.Launch = true
 
-			installProcess.ShouldRunCall.Returns.Should = false
-
-			err := os.WriteFile(filepath.Join(layersDir, "build-gems.toml"), []byte(`
-build = true
-cache = true
-
-[metadata]
-  stack = "some-other-stack"
-	cache_sha = "some-checksum"
-	ruby_version = "some-version"
-`), 0600)
-			Expect(err).NotTo(HaveOccurred())
-
-			err = os.WriteFile(filepath.Join(layersDir, "launch-gems.toml"), []byte(`
-launch = true
+			gemfileParser.ParseGroupsCall.Returns.GemfileGroups = bundleinstall.GemfileGroups{
+				Groups: map[string][]string{"rack": {"default"}},
+			}
+			lockfileParser.ParseCall.Returns.Lockfile = lockfile.Lockfile{
+				Sources: []lockfile.Source{
+					{
+						Type:    lockfile.SourceTypeGem,
+						Remotes: []string{"https://rubygems.org/"},
+						Specs:   []lockfile.Spec{{Name: "rack", Version: "3.0.8"}},
+					},
+				},
+				Dependencies: []lockfile.Dependency{{Name: "rack"}},
+			}
 
-[metadata]
-	stack = "some-other-stack"
-	cache_sha = "some-checksum"
-	ruby_version = "some-version"
-`), 0600)
-			Expect(err).NotTo(HaveOccurred())
+			Expect(os.MkdirAll(filepath.Join(layersDir, "build-gems", "ruby", "some-abi-version", "gems", "rack-3.0.8"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layersDir, "build-gems", "ruby", "some-abi-version", "gems", "rack-3.0.8", "lib.rb"), nil, 0600)).To(Succeed())
 		})
 
-		it("returns a result that does NOT reuse the existing layer", func() {
+		it("shares the build install with the launch layer without running bundler again", func() {
 			result, err := build(buildContext)
 			Expect(err).NotTo(HaveOccurred())
 
-			layers := result.Layers
-			Expect(layers).To(HaveLen(2))
-
-			buildLayer := layers[0]
-			Expect(buildLayer.Name).To(Equal("build-gems"))
-			Expect(buildLayer.Path).To(Equal(filepath.Join(layersDir, "build-gems")))
-
-			Expect(buildLayer.Build).To(BeTrue())
-			Expect(buildLayer.Launch).To(BeFalse())
-			Expect(buildLayer.Cache).To(BeTrue())
-
-			launchLayer := layers[1]
-			Expect(launchLayer.Name).To(Equal("launch-gems"))
-			Expect(launchLayer.Path).To(Equal(filepath.Join(layersDir, "launch-gems")))
-
-			Expect(launchLayer.Build).To(BeFalse())
-			Expect(launchLayer.Launch).To(BeTrue())
-			Expect(launchLayer.Cache).To(BeFalse())
+			Expect(installProcess.ExecuteCall.CallCount).To(Equal(1))
+			Expect(installProcess.ExecuteCall.Receives.LayerPath).To(Equal(filepath.Join(layersDir, "build-gems")))
 
-			Expect(filepath.Join(workingDir, ".bundle", "config")).NotTo(BeAnExistingFile())
+			Expect(gemfileParser.ParseGroupsCall.Receives.Path).To(Equal(filepath.Join(workingDir, "Gemfile")))
 
-			Expect(installProcess.ShouldRunCall.Receives.Metadata).To(Equal(map[string]interface{}{
-				"stack":        "some-other-stack",
-				"cache_sha":    "some-checksum",
-				"ruby_version": "some-version",
+			Expect(installProcess.ConfigureCall.CallCount).To(Equal(1))
+			Expect(installProcess.ConfigureCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(installProcess.ConfigureCall.Receives.LayerPath).To(Equal(filepath.Join(layersDir, "launch-gems")))
+			Expect(installProcess.ConfigureCall.Receives.Config).To(Equal(map[string]string{
+				"path":    filepath.Join(layersDir, "launch-gems"),
+				"without": "development:test",
+				"clean":   "true",
 			}))
-			Expect(installProcess.ShouldRunCall.Receives.WorkingDir).To(Equal(workingDir))
-			Expect(installProcess.ExecuteCall.CallCount).To(Equal(2))
 
-			Expect(buffer.String()).To(ContainSubstring("Some Buildpack some-version"))
-			Expect(buffer.String()).To(ContainSubstring("Stack upgraded from some-other-stack to , clearing cached gems"))
-			Expect(buffer.String()).To(ContainSubstring("Executing build environment install process"))
-			Expect(buffer.String()).To(ContainSubstring("Executing launch environment install process"))
+			Expect(filepath.Join(layersDir, "launch-gems", "ruby", "some-abi-version", "gems", "rack-3.0.8", "lib.rb")).To(BeAnExistingFile())
+			Expect(result.Layers[1].Launch).To(BeTrue())
+			Expect(result.Layers[1].Metadata).To(HaveKeyWithValue("groups", "without=development:test;with=;only="))
+
+			Expect(buffer).To(ContainLines(
+				"    Transferring gems from the build layer",
+				MatchRegexp(`      Reflinked \d+, hardlinked \d+ and copied \d+ files`),
+				MatchRegexp(`      Completed in \d+m?s`),
+				"    Sharing the build environment install, as it holds the same gems",
+				"      Completed in 0s",
+			))
 		})
-	})
 
-	context("failure cases", func() {
-		context("when the layers directory cannot be written to", func() {
+		context("when the Gemfile does not exist", func() {
 			it.Before(func() {
-				Expect(os.Chmod(layersDir, 0000)).To(Succeed())
+				gemfileParser.ParseGroupsCall.Returns.Error = fmt.Errorf("failed to parse Gemfile: %w", os.ErrNotExist)
 			})
 
-			it.After(func() {
-				Expect(os.Chmod(layersDir, os.ModePerm)).To(Succeed())
+			it("installs the launch gems with bundler", func() {
+				_, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(installProcess.ExecuteCall.CallCount).To(Equal(2))
+				Expect(installProcess.ConfigureCall.CallCount).To(Equal(0))
 			})
+		})
 
-			context("when a build layer is required", func() {
+		context("failure cases", func() {
+			context("when the Gemfile groups cannot be parsed", func() {
 				it.Before(func() {
-					entryResolver.MergeLayerTypesCall.Returns.Build = true
+					gemfileParser.ParseGroupsCall.Returns.Error = errors.New("failed to parse Gemfile")
 				})
 
 				it("returns an error", func() {
 					_, err := build(buildContext)
-					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+					Expect(err).To(MatchError("failed to parse Gemfile"))
+				})
+			})
+
+			context("when the launch layer cannot be configured", func() {
+				it.Before(func() {
+					installProcess.ConfigureCall.Returns.Error = errors.New("failed to configure")
+				})
+
+				it("returns an error", func() {
+					_, err := build(buildContext)
+					Expect(err).To(MatchError("failed to configure"))
+				})
+			})
+		})
+	})
+
+	context("when the cached build layer holds gems for another Ruby ABI", func() {
+		it.Before(func() {
+			entryResolver.MergeLayerTypesCall.Returns.Build = true
+			installProcess.ShouldRunCall.Returns.Reasons = nil
+
+			Expect(os.MkdirAll(filepath.Join(layersDir, "build-gems", "ruby", "some-abi-version"), os.ModePerm)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(layersDir, "build-gems", "ruby", "other-abi-version"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layersDir, "build-gems", "ruby", "other-abi-version", "some-gem.gem"), make([]byte, 1500), 0600)).To(Succeed())
+		})
+
+		it("removes them and reports the reclaimed space", func() {
+			_, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(layersDir, "build-gems", "ruby", "some-abi-version")).To(BeADirectory())
+			Expect(filepath.Join(layersDir, "build-gems", "ruby", "other-abi-version")).NotTo(BeAnExistingFile())
+
+			Expect(buffer).To(ContainLines(
+				"  Removed gems installed for other Ruby ABIs, reclaiming 1.5 kB",
+				"    ruby/other-abi-version",
+			))
+		})
+	})
+
+	context("when the gem download cache holds gems that are no longer locked", func() {
+		var cachePath string
+
+		it.Before(func() {
+			entryResolver.MergeLayerTypesCall.Returns.Build = true
+			Expect(os.MkdirAll(filepath.Join(layersDir, "build-gems"), os.ModePerm)).To(Succeed())
+
+			lockfileParser.ParseCall.Returns.Lockfile = lockfile.Lockfile{
+				Sources: []lockfile.Source{
+					{
+						Type:    lockfile.SourceTypeGem,
+						Remotes: []string{"https://rubygems.org/"},
+						Specs: []lockfile.Spec{
+							{Name: "rack", Version: "3.0.8"},
+							{Name: "nokogiri", Version: "1.16.0", Platform: "x86_64-linux"},
+						},
+					},
+				},
+			}
+
+			cachePath = filepath.Join(layersDir, "gem-cache", "gems", "rubygems.org.443.some-digest")
+			Expect(os.MkdirAll(cachePath, os.ModePerm)).To(Succeed())
+			for _, name := range []string{"rack-3.0.8.gem", "rack-2.2.8.gem", "nokogiri-1.16.0-x86_64-linux.gem", "nokogiri-1.15.0-x86_64-linux.gem"} {
+				Expect(os.WriteFile(filepath.Join(cachePath, name), nil, 0600)).To(Succeed())
+			}
+		})
+
+		it("prunes them from the cache", func() {
+			_, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(cachePath, "rack-3.0.8.gem")).To(BeAnExistingFile())
+			Expect(filepath.Join(cachePath, "nokogiri-1.16.0-x86_64-linux.gem")).To(BeAnExistingFile())
+			Expect(filepath.Join(cachePath, "rack-2.2.8.gem")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(cachePath, "nokogiri-1.15.0-x86_64-linux.gem")).NotTo(BeAnExistingFile())
+
+			Expect(buffer).To(ContainLines(
+				"  Pruned 2 gem(s) not in Gemfile.lock from the download cache",
+			))
+		})
+	})
+
+	context("when the lockfile does not list the platform of the build target", func() {
+		it.Before(func() {
+			buildContext.TargetInfo = packit.TargetInfo{OS: "linux", Arch: "arm64"}
+			entryResolver.MergeLayerTypesCall.Returns.Build = true
+			entryResolver.MergeLayerTypesCall.Returns.Launch = true
+			Expect(os.MkdirAll(filepath.Join(layersDir, "build-gems"), os.ModePerm)).To(Succeed())
+
+			lockfileParser.ParseCall.Returns.Lockfile = lockfile.Lockfile{
+				Platforms: []string{"arm64-darwin", "x86_64-linux"},
+			}
+		})
+
+		it("warns with instructions to add the platform", func() {
+			_, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(lockfileParser.ParseCall.Receives.Path).To(Equal(filepath.Join(workingDir, "Gemfile.lock")))
+
+			Expect(buffer).To(ContainLines(
+				"  WARNING: Gemfile.lock does not list the aarch64-linux platform of the build target (PLATFORMS: arm64-darwin, x86_64-linux)",
+				"    Run `bundle lock --add-platform aarch64-linux` and commit the updated Gemfile.lock",
+				"    Alternatively, set $BP_BUNDLE_FORCE_RUBY_PLATFORM=true to install the ruby platform variant of each gem",
+			))
+			Expect(installProcess.ExecuteCall.Receives.Config).NotTo(HaveKey("force_ruby_platform"))
+		})
+
+		context("when BP_BUNDLE_FORCE_RUBY_PLATFORM is set", func() {
+			it.Before(func() {
+				build = bundleinstall.Build(
+					entryResolver,
+					installProcess,
+					sbomGenerator,
+					lockfileParser,
+					gemfileParser,
+					gitCache,
+					scribe.NewEmitter(buffer),
+					clock,
+					bundleinstall.Environment{
+						ForceRubyPlatform: true,
+						LaunchGroups:      bundleinstall.GemGroups{Without: []string{"development", "test"}},
+					},
+				)
+			})
+
+			it("configures bundler to force the ruby platform", func() {
+				_, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer).To(ContainLines(
+					"    Forcing the ruby platform as $BP_BUNDLE_FORCE_RUBY_PLATFORM is set, native extensions will be compiled from source",
+				))
+
+				Expect(installProcess.ExecuteCall.CallCount).To(Equal(2))
+				Expect(installProcess.ExecuteCall.Receives.Config).To(Equal(map[string]string{
+					"path":                filepath.Join(layersDir, "launch-gems"),
+					"without":             "development:test",
+					"clean":               "true",
+					"force_ruby_platform": "true",
+				}))
+			})
+		})
+
+		context("when the lockfile lists the platform", func() {
+			it.Before(func() {
+				lockfileParser.ParseCall.Returns.Lockfile.Platforms = []string{"aarch64-linux-gnu"}
+			})
+
+			it("does not warn", func() {
+				_, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).NotTo(ContainSubstring("WARNING"))
+			})
+		})
+	})
+
+	context("when the app has no lockfile", func() {
+		it.Before(func() {
+			entryResolver.MergeLayerTypesCall.Returns.Build = true
+			Expect(os.MkdirAll(filepath.Join(layersDir, "build-gems"), os.ModePerm)).To(Succeed())
+
+			installProcess.ExecuteCall.Stub = func(workingDir, path, downloadCachePath string, config map[string]string, keepBuildFiles bool) error {
+				return os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("generated-lockfile"), 0600)
+			}
+		})
+
+		it("saves the lockfile generated by Bundler in the layer", func() {
+			_, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			content, err := os.ReadFile(filepath.Join(layersDir, "build-gems", "Gemfile.lock"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("generated-lockfile"))
+
+			Expect(buffer.String()).To(ContainSubstring(fmt.Sprintf("Saved the Gemfile.lock generated by Bundler to %s", filepath.Join(layersDir, "build-gems", "Gemfile.lock"))))
+		})
+
+		context("when BP_BUNDLE_REQUIRE_LOCKFILE is set", func() {
+			it.Before(func() {
+				build = bundleinstall.Build(
+					entryResolver,
+					installProcess,
+					sbomGenerator,
+					lockfileParser,
+					gemfileParser,
+					gitCache,
+					scribe.NewEmitter(buffer),
+					clock,
+					bundleinstall.Environment{
+						RequireLockfile: true,
+						LaunchGroups:    bundleinstall.GemGroups{Without: []string{"development", "test"}},
+					},
+				)
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("failed to install gems: Gemfile.lock does not exist and $BP_BUNDLE_REQUIRE_LOCKFILE is set, run `bundle lock` and commit the Gemfile.lock"))
+
+				Expect(installProcess.ExecuteCall.CallCount).To(Equal(0))
+			})
+		})
+	})
+
+	context("when BP_BUNDLE_FROZEN is set", func() {
+		it.Before(func() {
+			entryResolver.MergeLayerTypesCall.Returns.Build = true
+			entryResolver.MergeLayerTypesCall.Returns.Launch = true
+			Expect(os.MkdirAll(filepath.Join(layersDir, "build-gems"), os.ModePerm)).To(Succeed())
+
+			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), nil, 0600)).To(Succeed())
+			lockfileParser.ParseCall.Returns.Lockfile = lockfile.Lockfile{
+				Dependencies: []lockfile.Dependency{
+					{Name: "puma"},
+					{Name: "rails", Requirements: []string{"~> 7.1.0"}},
+				},
+			}
+			gemfileParser.ParseDependenciesCall.Returns.GemfileDependencies = bundleinstall.GemfileDependencies{
+				Dependencies: []lockfile.Dependency{
+					{Name: "rails", Requirements: []string{"~> 7.1.0"}},
+					{Name: "puma"},
+				},
+			}
+
+			build = bundleinstall.Build(
+				entryResolver,
+				installProcess,
+				sbomGenerator,
+				lockfileParser,
+				gemfileParser,
+				gitCache,
+				scribe.NewEmitter(buffer),
+				clock,
+				bundleinstall.Environment{
+					Frozen:       true,
+					LaunchGroups: bundleinstall.GemGroups{Without: []string{"development", "test"}},
+				},
+			)
+		})
+
+		it("configures bundler in frozen deployment mode", func() {
+			_, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(gemfileParser.ParseDependenciesCall.Receives.Path).To(Equal(filepath.Join(workingDir, "Gemfile")))
+
+			Expect(installProcess.ExecuteCall.CallCount).To(Equal(1))
+			Expect(installProcess.ExecuteCall.Receives.Config).To(Equal(map[string]string{
+				"path":       filepath.Join(layersDir, "build-gems"),
+				"clean":      "true",
+				"deployment": "true",
+				"frozen":     "true",
+			}))
+
+			Expect(installProcess.ConfigureCall.CallCount).To(Equal(1))
+			Expect(installProcess.ConfigureCall.Receives.Config).To(Equal(map[string]string{
+				"path":       filepath.Join(layersDir, "launch-gems"),
+				"without":    "development:test",
+				"clean":      "true",
+				"deployment": "true",
+				"frozen":     "true",
+			}))
+		})
+
+		context("when the Gemfile has drifted from the lockfile", func() {
+			it.Before(func() {
+				gemfileParser.ParseDependenciesCall.Returns.GemfileDependencies = bundleinstall.GemfileDependencies{
+					Dependencies: []lockfile.Dependency{
+						{Name: "rails", Requirements: []string{"~> 7.2.0"}},
+						{Name: "sidekiq"},
+					},
+				}
+			})
+
+			it("returns an error with the differences", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("failed to install gems in frozen mode: the dependencies in Gemfile do not match the DEPENDENCIES in Gemfile.lock, run `bundle install` and commit the Gemfile.lock:\n" +
+					"+ sidekiq\n" +
+					"- puma\n" +
+					"~ rails (~> 7.2.0), locked as rails (~> 7.1.0)"))
+
+				Expect(installProcess.ExecuteCall.CallCount).To(Equal(0))
+			})
+		})
+
+		context("when the lockfile does not exist", func() {
+			it.Before(func() {
+				Expect(os.Remove(filepath.Join(workingDir, "Gemfile.lock"))).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("failed to install gems in frozen mode: Gemfile.lock does not exist, run `bundle lock` and commit the Gemfile.lock"))
+			})
+		})
+
+		context("when the Gemfile cannot be parsed", func() {
+			it.Before(func() {
+				gemfileParser.ParseDependenciesCall.Returns.Error = errors.New("failed to parse Gemfile")
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("failed to parse Gemfile"))
+
+				Expect(installProcess.ExecuteCall.CallCount).To(Equal(0))
+			})
+		})
+
+		context("when the lockfile does not list the platform of the build target", func() {
+			it.Before(func() {
+				buildContext.TargetInfo = packit.TargetInfo{OS: "linux", Arch: "amd64"}
+				lockfileParser.ParseCall.Returns.Lockfile.Platforms = []string{"arm64-darwin"}
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("failed to install gems in frozen mode: Gemfile.lock does not list the x86_64-linux platform of the build target (PLATFORMS: arm64-darwin), run `bundle lock --add-platform x86_64-linux` and commit the Gemfile.lock"))
+			})
+		})
+	})
+
+	context("when reusing a layer", func() {
+		it.Before(func() {
+			entryResolver.MergeLayerTypesCall.Returns.Build = true
+			entryResolver.MergeLayerTypesCall.Returns.Launch = true
+
+			installProcess.ShouldRunCall.Returns.Reasons = nil
+
+			err := os.WriteFile(filepath.Join(layersDir, "build-gems.toml"), []byte(`
+build = true
+cache = true
+
+[metadata]
+  stack = ""
+	ruby_version = "some-version"
+
+[metadata.cache_key]
+	gemfile = "some-checksum"
+	lockfile = ""
+	bundle_config = ""
+	vendored_gems = ""
+	bundle_environment = ""
+	buildpack_config = ""
+`), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = os.WriteFile(filepath.Join(layersDir, "launch-gems.toml"), []byte(`
+launch = true
+
+[metadata]
+	stack = ""
+	ruby_version = "some-version"
+
+[metadata.cache_key]
+	gemfile = "some-checksum"
+	lockfile = ""
+	bundle_config = ""
+	vendored_gems = ""
+	bundle_environment = ""
+	buildpack_config = ""
+`), 0600)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it("returns a result that reuses the existing layer", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			layers := result.Layers
+			Expect(layers).To(HaveLen(4))
+
+			buildLayer := layers[0]
+			Expect(buildLayer.Name).To(Equal("build-gems"))
+			Expect(buildLayer.Path).To(Equal(filepath.Join(layersDir, "build-gems")))
+
+			Expect(buildLayer.Build).To(BeTrue())
+			Expect(buildLayer.Launch).To(BeFalse())
+			Expect(buildLayer.Cache).To(BeTrue())
+
+			launchLayer := layers[1]
+			Expect(launchLayer.Name).To(Equal("launch-gems"))
+			Expect(launchLayer.Path).To(Equal(filepath.Join(layersDir, "launch-gems")))
+
+			Expect(launchLayer.Build).To(BeFalse())
+			Expect(launchLayer.Launch).To(BeTrue())
+			Expect(launchLayer.Cache).To(BeFalse())
+
+			Expect(filepath.Join(workingDir, ".bundle", "config")).NotTo(BeAnExistingFile())
+
+			Expect(installProcess.ShouldRunCall.Receives.Metadata).To(Equal(map[string]interface{}{
+				"stack": "",
+				"cache_key": map[string]interface{}{
+					"gemfile":            "some-checksum",
+					"lockfile":           "",
+					"bundle_config":      "",
+					"vendored_gems":      "",
+					"bundle_environment": "",
+					"buildpack_config":   "",
+				},
+				"ruby_version": "some-version",
+			}))
+			Expect(installProcess.ShouldRunCall.Receives.WorkingDir).To(Equal(workingDir))
+
+			Expect(installProcess.ExecuteCall.CallCount).To(Equal(0))
+
+			Expect(buffer.String()).To(ContainSubstring("Some Buildpack some-version"))
+			Expect(buffer.String()).To(ContainSubstring("Reusing cached layer"))
+			Expect(buffer).To(ContainLines(
+				"Some Buildpack some-version",
+				fmt.Sprintf("  Reusing cached layer %s", filepath.Join(layersDir, "build-gems")),
+				"",
+				fmt.Sprintf("  Reusing cached layer %s", filepath.Join(layersDir, "launch-gems")),
+			))
+		})
+	})
+
+	context("when trying to reuse a layer but the gem groups change", func() {
+		it.Before(func() {
+			entryResolver.MergeLayerTypesCall.Returns.Launch = true
+
+			installProcess.ShouldRunCall.Returns.Reasons = nil
+
+			err := os.WriteFile(filepath.Join(layersDir, "launch-gems.toml"), []byte(`
+launch = true
+
+[metadata]
+	stack = ""
+	ruby_version = "some-version"
+	groups = "without=development:test;with=;only="
+
+[metadata.cache_key]
+	gemfile = "some-checksum"
+	lockfile = ""
+	bundle_config = ""
+	vendored_gems = ""
+	bundle_environment = ""
+	buildpack_config = ""
+`), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			build = bundleinstall.Build(
+				entryResolver,
+				installProcess,
+				sbomGenerator,
+				lockfileParser,
+				gemfileParser,
+				gitCache,
+				scribe.NewEmitter(buffer),
+				clock,
+				bundleinstall.Environment{
+					LaunchGroups: bundleinstall.GemGroups{
+						Without: []string{"development", "test", "assets"},
+						With:    []string{"production_only"},
+					},
+				},
+			)
+		})
+
+		it("installs the newly selected groups", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(installProcess.ExecuteCall.CallCount).To(Equal(1))
+			Expect(installProcess.ExecuteCall.Receives.Config).To(Equal(map[string]string{
+				"path":    filepath.Join(layersDir, "launch-gems"),
+				"without": "development:test:assets",
+				"with":    "production_only",
+				"clean":   "true",
+			}))
+
+			Expect(result.Layers[0].Metadata).To(HaveKeyWithValue("groups", "without=development:test:assets;with=production_only;only="))
+			Expect(result.Layers[0].Metadata).To(HaveKeyWithValue("install_reasons", []string{
+				"gem groups changed from without=development:test;with=;only= to without=development:test:assets;with=production_only;only=",
+			}))
+
+			Expect(buffer).To(ContainLines(
+				"  Executing launch environment install process",
+				"    Installing because:",
+				"      gem groups changed from without=development:test;with=;only= to without=development:test:assets;with=production_only;only=",
+			))
+		})
+	})
+
+	context("when trying to reuse a layer but the build target changes", func() {
+		it.Before(func() {
+			entryResolver.MergeLayerTypesCall.Returns.Build = true
+			entryResolver.MergeLayerTypesCall.Returns.Launch = true
+
+			installProcess.ShouldRunCall.Returns.Reasons = nil
+
+			buildContext.TargetInfo = packit.TargetInfo{OS: "linux", Arch: "arm64"}
+			buildContext.TargetDistro = packit.TargetDistro{Name: "ubuntu", Version: "24.04"}
+
+			Expect(os.MkdirAll(filepath.Join(layersDir, "build-gems", "ruby"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layersDir, "build-gems", "ruby", "nokogiri.so"), nil, 0600)).To(Succeed())
+
+			for _, name := range []string{"build-gems", "launch-gems"} {
+				Expect(os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", name)), []byte(`
+[metadata]
+	stack = ""
+	ruby_version = "some-version"
+
+[metadata.target]
+	os = "linux"
+	arch = "amd64"
+	distro_name = "ubuntu"
+	distro_version = "22.04"
+`), 0600)).To(Succeed())
+			}
+		})
+
+		it("clears the layers and records the new target", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers).To(HaveLen(4))
+			for _, layer := range result.Layers[:2] {
+				Expect(layer.Metadata).To(HaveKeyWithValue("target", map[string]interface{}{
+					"os":             "linux",
+					"arch":           "arm64",
+					"distro_name":    "ubuntu",
+					"distro_version": "24.04",
+				}))
+				Expect(layer.Metadata).To(HaveKeyWithValue("install_reasons", []string{
+					"build target changed from linux/amd64 (ubuntu 22.04) to linux/arm64 (ubuntu 24.04)",
+				}))
+			}
+
+			Expect(filepath.Join(layersDir, "build-gems", "ruby", "nokogiri.so")).NotTo(BeAnExistingFile())
+			Expect(installProcess.ExecuteCall.CallCount).To(Equal(2))
+
+			Expect(buffer.String()).To(ContainSubstring("Build target changed from linux/amd64 (ubuntu 22.04) to linux/arm64 (ubuntu 24.04), clearing cached gems"))
+		})
+
+		context("when only the distribution changes", func() {
+			it.Before(func() {
+				buildContext.TargetInfo = packit.TargetInfo{OS: "linux", Arch: "amd64"}
+			})
+
+			it("clears the layers", func() {
+				_, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(installProcess.ExecuteCall.CallCount).To(Equal(2))
+				Expect(buffer.String()).To(ContainSubstring("Build target changed from linux/amd64 (ubuntu 22.04) to linux/amd64 (ubuntu 24.04), clearing cached gems"))
+			})
+		})
+
+		context("when the build target is the same", func() {
+			it.Before(func() {
+				buildContext.TargetInfo = packit.TargetInfo{OS: "linux", Arch: "amd64"}
+				buildContext.TargetDistro = packit.TargetDistro{Name: "ubuntu", Version: "22.04"}
+			})
+
+			it("reuses the layers", func() {
+				_, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(installProcess.ExecuteCall.CallCount).To(Equal(0))
+				Expect(filepath.Join(layersDir, "build-gems", "ruby", "nokogiri.so")).To(BeAnExistingFile())
+			})
+		})
+	})
+
+	context("when BP_BUNDLE_FORCE_INSTALL is set", func() {
+		it.Before(func() {
+			entryResolver.MergeLayerTypesCall.Returns.Build = true
+			entryResolver.MergeLayerTypesCall.Returns.Launch = true
+
+			installProcess.ShouldRunCall.Returns.Reasons = nil
+
+			Expect(os.MkdirAll(filepath.Join(layersDir, "build-gems", "ruby"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layersDir, "build-gems", "ruby", "broken.so"), nil, 0600)).To(Succeed())
+
+			Expect(os.WriteFile(filepath.Join(layersDir, "build-gems.toml"), []byte(`
+build = true
+cache = true
+
+[metadata]
+	stack = ""
+	ruby_version = "some-version"
+`), 0600)).To(Succeed())
+
+			Expect(os.WriteFile(filepath.Join(layersDir, "launch-gems.toml"), []byte(`
+launch = true
+
+[metadata]
+	stack = ""
+	ruby_version = "some-version"
+`), 0600)).To(Succeed())
+
+			build = bundleinstall.Build(
+				entryResolver,
+				installProcess,
+				sbomGenerator,
+				lockfileParser,
+				gemfileParser,
+				gitCache,
+				scribe.NewEmitter(buffer),
+				clock,
+				bundleinstall.Environment{
+					ForceInstall: true,
+					LaunchGroups: bundleinstall.GemGroups{Without: []string{"development", "test"}},
+				},
+			)
+		})
+
+		it("clears the layers and installs the gems again", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers).To(HaveLen(4))
+			Expect(result.Layers[0].Build).To(BeTrue())
+			Expect(result.Layers[0].Cache).To(BeTrue())
+			Expect(result.Layers[0].Metadata).To(HaveKeyWithValue("install_reasons", []string{"clean install requested by the user"}))
+			Expect(result.Layers[1].Launch).To(BeTrue())
+			Expect(result.Layers[1].Metadata).To(HaveKeyWithValue("install_reasons", []string{"clean install requested by the user"}))
+
+			Expect(filepath.Join(layersDir, "build-gems", "ruby", "broken.so")).NotTo(BeAnExistingFile())
+			Expect(installProcess.ExecuteCall.CallCount).To(Equal(2))
+
+			Expect(buffer).To(ContainLines(
+				"  Clearing cached gems, as requested by the user",
+				"  Executing build environment install process",
+				"    Installing because:",
+				"      clean install requested by the user",
+			))
+		})
+	})
+
+	context("when trying to reuse a layer but the stack changes", func() {
+		it.Before(func() {
+			entryResolver.MergeLayerTypesCall.Returns.Build = true
+			entryResolver.MergeLayerTypesCall.Returns.Launch = true
+
+			installProcess.ShouldRunCall.Returns.Reasons = nil
+
+			err := os.WriteFile(filepath.Join(layersDir, "build-gems.toml"), []byte(`
+build = true
+cache = true
+
+[metadata]
+  stack = "some-other-stack"
+	ruby_version = "some-version"
+
+[metadata.cache_key]
+	gemfile = "some-checksum"
+	lockfile = ""
+	bundle_config = ""
+	vendored_gems = ""
+	bundle_environment = ""
+	buildpack_config = ""
+`), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = os.WriteFile(filepath.Join(layersDir, "launch-gems.toml"), []byte(`
+launch = true
+
+[metadata]
+	stack = "some-other-stack"
+	ruby_version = "some-version"
+
+[metadata.cache_key]
+	gemfile = "some-checksum"
+	lockfile = ""
+	bundle_config = ""
+	vendored_gems = ""
+	bundle_environment = ""
+	buildpack_config = ""
+`), 0600)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it("returns a result that does NOT reuse the existing layer", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			layers := result.Layers
+			Expect(layers).To(HaveLen(4))
+
+			buildLayer := layers[0]
+			Expect(buildLayer.Name).To(Equal("build-gems"))
+			Expect(buildLayer.Path).To(Equal(filepath.Join(layersDir, "build-gems")))
+
+			Expect(buildLayer.Build).To(BeTrue())
+			Expect(buildLayer.Launch).To(BeFalse())
+			Expect(buildLayer.Cache).To(BeTrue())
+
+			launchLayer := layers[1]
+			Expect(launchLayer.Name).To(Equal("launch-gems"))
+			Expect(launchLayer.Path).To(Equal(filepath.Join(layersDir, "launch-gems")))
+
+			Expect(launchLayer.Build).To(BeFalse())
+			Expect(launchLayer.Launch).To(BeTrue())
+			Expect(launchLayer.Cache).To(BeFalse())
+
+			Expect(filepath.Join(workingDir, ".bundle", "config")).NotTo(BeAnExistingFile())
+
+			Expect(installProcess.ShouldRunCall.Receives.Metadata).To(Equal(map[string]interface{}{
+				"stack": "some-other-stack",
+				"cache_key": map[string]interface{}{
+					"gemfile":            "some-checksum",
+					"lockfile":           "",
+					"bundle_config":      "",
+					"vendored_gems":      "",
+					"bundle_environment": "",
+					"buildpack_config":   "",
+				},
+				"ruby_version": "some-version",
+			}))
+			Expect(installProcess.ShouldRunCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(installProcess.ExecuteCall.CallCount).To(Equal(2))
+
+			Expect(buffer.String()).To(ContainSubstring("Some Buildpack some-version"))
+			Expect(buffer.String()).To(ContainSubstring("Stack upgraded from some-other-stack to , clearing cached gems"))
+			Expect(buffer).To(ContainLines(
+				"  Executing build environment install process",
+				"    Installing because:",
+				"      stack changed from some-other-stack to ",
+			))
+			Expect(buffer).To(ContainLines(
+				"  Executing launch environment install process",
+				"    Installing because:",
+				"      stack changed from some-other-stack to ",
+			))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when the layers directory cannot be written to", func() {
+			it.Before(func() {
+				Expect(os.Chmod(layersDir, 0000)).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Chmod(layersDir, os.ModePerm)).To(Succeed())
+			})
+
+			context("when a build layer is required", func() {
+				it.Before(func() {
+					entryResolver.MergeLayerTypesCall.Returns.Build = true
+				})
+
+				it("returns an error", func() {
+					_, err := build(buildContext)
+					Expect(err).To(MatchError(ContainSubstring("permission denied")))
 				})
 			})
 
@@ -702,6 +1729,43 @@ launch = true
 			})
 		})
 
+		context("when the app has both a Gemfile and a gems.rb", func() {
+			it.Before(func() {
+				entryResolver.MergeLayerTypesCall.Returns.Build = true
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), nil, 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "gems.rb"), nil, 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(ContainSubstring("found both Gemfile and gems.rb files")))
+			})
+		})
+
+		context("when the lockfile cannot be parsed", func() {
+			it.Before(func() {
+				entryResolver.MergeLayerTypesCall.Returns.Build = true
+				lockfileParser.ParseCall.Returns.Error = errors.New("failed to parse lockfile")
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("failed to parse lockfile"))
+			})
+		})
+
+		context("when the cached git sources cannot be verified", func() {
+			it.Before(func() {
+				entryResolver.MergeLayerTypesCall.Returns.Build = true
+				gitCache.VerifyCall.Returns.Error = errors.New("failed to verify git cache")
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("failed to verify git cache"))
+			})
+		})
+
 		context("when the install process fails to determine if it should run", func() {
 			it.Before(func() {
 				entryResolver.MergeLayerTypesCall.Returns.Build = true
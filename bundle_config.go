@@ -0,0 +1,80 @@
+package bundleinstall
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readBundleConfig reads the Bundler configuration file at the given path into
+// a map of setting names, such as BUNDLE_GEMFILE, to their values. A missing
+// file results in an empty configuration.
+func readBundleConfig(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to read bundle config: %w", err)
+	}
+
+	var settings map[string]interface{}
+	err = yaml.Unmarshal(content, &settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bundle config %s: %w", path, err)
+	}
+
+	config := map[string]string{}
+	for key, value := range settings {
+		config[key] = fmt.Sprint(value)
+	}
+
+	return config, nil
+}
+
+// writeBundleConfig sets the given settings, such as "path", in the Bundler
+// configuration file at the given path, as "bundle config" would, keeping any
+// other settings already in the file.
+func writeBundleConfig(path string, settings map[string]string) error {
+	config, err := readBundleConfig(path)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range settings {
+		config[bundleConfigKey(key)] = value
+	}
+
+	var keys []string
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	content := "---\n"
+	for _, key := range keys {
+		content += fmt.Sprintf("%s: %s\n", key, strconv.Quote(config[key]))
+	}
+
+	err = os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write bundle config: %w", err)
+	}
+
+	return nil
+}
+
+// bundleConfigKey returns the name that Bundler stores the given setting
+// under, such that "force_ruby_platform" is stored as
+// BUNDLE_FORCE_RUBY_PLATFORM.
+func bundleConfigKey(setting string) string {
+	key := strings.ReplaceAll(setting, ".", "__")
+	key = strings.ReplaceAll(key, "-", "___")
+
+	return "BUNDLE_" + strings.ToUpper(key)
+}
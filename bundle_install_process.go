@@ -17,17 +17,17 @@ import (
 //go:generate faux --interface Executable --output fakes/executable.go
 //go:generate faux --interface VersionResolver --output fakes/version_resolver.go
 //go:generate faux --interface Calculator --output fakes/calculator.go
+//go:generate faux --interface GemfileReferenceParser --output fakes/gemfile_reference_parser.go
 
 // Executable defines the interface for executing an external process.
 type Executable interface {
 	Execute(pexec.Execution) error
 }
 
-// VersionResolver defines the interface for looking up and comparing the
-// versions of Ruby installed in the environment.
+// VersionResolver defines the interface for looking up the ABI of the Ruby
+// installed in the environment.
 type VersionResolver interface {
-	Lookup() (version string, err error)
-	CompareMajorMinor(left string, right string) (bool, error)
+	Lookup() (RubyABI, error)
 }
 
 // Calculator defines the interface for calculating a checksum of the given set
@@ -36,68 +36,193 @@ type Calculator interface {
 	Sum(paths ...string) (string, error)
 }
 
+// GemfileReferenceParser defines the interface for finding the files and
+// directories that a Gemfile refers to.
+type GemfileReferenceParser interface {
+	ParseReferences(path string) (GemfileReferences, error)
+}
+
 // BundleInstallProcess performs the "bundle install" build process.
 type BundleInstallProcess struct {
 	executable      Executable
 	logger          scribe.Emitter
 	versionResolver VersionResolver
 	calculator      Calculator
+	gemfileParser   GemfileReferenceParser
+	lockfileParser  LockfileParser
 }
 
 // NewBundleInstallProcess initializes an instance of BundleInstallProcess.
-func NewBundleInstallProcess(executable Executable, logger scribe.Emitter, versionResolver VersionResolver, calculator Calculator) BundleInstallProcess {
+func NewBundleInstallProcess(executable Executable, logger scribe.Emitter, versionResolver VersionResolver, calculator Calculator, gemfileParser GemfileReferenceParser, lockfileParser LockfileParser) BundleInstallProcess {
 	return BundleInstallProcess{
 		executable:      executable,
 		logger:          logger,
 		versionResolver: versionResolver,
 		calculator:      calculator,
+		gemfileParser:   gemfileParser,
+		lockfileParser:  lockfileParser,
 	}
 }
 
-// ShouldRun will return true if it is determined that the BundleInstallProcess
-// be executed during the build phase.
+// ShouldRun returns the reasons that the BundleInstallProcess should be
+// executed during the build phase, rather than reusing the layer described by
+// the given metadata. There are no reasons when the layer can be reused.
+//
+// The install process should be executed if there is no previous metadata,
+// RubyABI or CacheKey, if any fact about the ABI of Ruby has changed, or if
+// any component of the CacheKey has changed. The ABI covers the ABI version,
+// platform and engine of Ruby, along with whether it was built as a shared
+// library, the libraries it is linked against and its YJIT support. When the
+// InstallSettings ask for it, any change to the version of Ruby, including a
+// patch release, is also a reason to execute the install process.
 //
-// The criteria for determining that the install process should be executed is
-// if the major or minor version of Ruby has changed, or if the contents of the
-// Gemfile or Gemfile.lock have changed.
+// The key covers the application's .bundle/config, the vendored .gem files,
+// the BUNDLE_* environment variables, the given InstallSettings and the
+// contents of the Gemfile and Gemfile.lock, as identified by the given
+// Manifest.
 //
-// In addition to reporting if the install process should execute, this method
-// will return the current version of Ruby and the checksum of the Gemfile and
-// Gemfile.lock contents.
-func (ip BundleInstallProcess) ShouldRun(metadata map[string]interface{}, workingDir string) (bool, string, string, error) {
-	rubyVersion, err := ip.versionResolver.Lookup()
+// The Gemfiles evaluated through "eval_gemfile" and the gemspecs of gems
+// installed from a local path are checksummed along with the Gemfile. Path
+// gems outside of the application directory are an error, as they do not
+// exist in the build container.
+//
+// In addition to the reasons, this method will return the current RubyABI and
+// the CacheKey, which are to be stored in the layer metadata.
+func (ip BundleInstallProcess) ShouldRun(metadata map[string]interface{}, workingDir string, manifest Manifest, settings InstallSettings) ([]string, CacheKey, RubyABI, error) {
+	abi, err := ip.versionResolver.Lookup()
 	if err != nil {
-		return false, "", "", err
+		return nil, CacheKey{}, RubyABI{}, err
 	}
 
-	cachedRubyVersion, ok := metadata["ruby_version"].(string)
-	rubyVersionMatch := true
+	key, err := ip.cacheKey(workingDir, manifest, settings)
+	if err != nil {
+		return nil, CacheKey{}, RubyABI{}, err
+	}
+
+	if len(metadata) == 0 {
+		return []string{"no previous metadata"}, key, abi, nil
+	}
 
-	if ok {
-		rubyVersionMatch, err = ip.versionResolver.CompareMajorMinor(cachedRubyVersion, rubyVersion)
+	var reasons []string
+	cachedABI, ok := metadata["ruby_abi"].(map[string]interface{})
+	if !ok {
+		reasons = append(reasons, "no previous Ruby ABI")
+	} else {
+		descriptions := map[string]string{
+			"abi_version": "Ruby ABI version",
+			"platform":    "Ruby platform",
+			"engine":      "Ruby engine",
+			"shared":      "Ruby shared library setting",
+			"libs":        "Ruby linked libraries",
+			"yjit":        "Ruby YJIT support",
+		}
+
+		current := abi.Metadata()
+		for _, fact := range abi.Changed(cachedABI) {
+			previous, _ := cachedABI[fact].(string)
+			reasons = append(reasons, fmt.Sprintf("%s changed from %q to %q", descriptions[fact], previous, current[fact]))
+		}
+	}
+
+	if cachedVersion, ok := metadata["ruby_version"].(string); ok && settings.RebuildOnRubyPatch && cachedVersion != abi.Version {
+		reasons = append(reasons, fmt.Sprintf("Ruby version changed from %s to %s", cachedVersion, abi.Version))
+	}
+
+	cachedKey, ok := metadata["cache_key"]
+	if !ok {
+		return append(reasons, "no previous cache key"), key, abi, nil
+	}
+
+	for _, component := range key.Changed(cachedKey) {
+		switch component {
+		case "gemfile":
+			reasons = append(reasons, fmt.Sprintf("%s changed", filepath.Base(manifest.Gemfile)))
+		case "lockfile":
+			reasons = append(reasons, fmt.Sprintf("%s changed", filepath.Base(manifest.Lockfile)))
+		case "bundle_config":
+			reasons = append(reasons, ".bundle/config changed")
+		case "vendored_gems":
+			reasons = append(reasons, "vendored gems changed")
+		case "bundle_environment":
+			reasons = append(reasons, "BUNDLE_* environment variables changed")
+		case "buildpack_config":
+			reasons = append(reasons, "configuration changed")
+		}
+	}
+
+	return reasons, key, abi, nil
+}
+
+func (ip BundleInstallProcess) cacheKey(workingDir string, manifest Manifest, settings InstallSettings) (CacheKey, error) {
+	var key CacheKey
+
+	references, err := ip.referencedFiles(workingDir, manifest)
+	if err != nil {
+		return CacheKey{}, err
+	}
+
+	key.Gemfile, err = ip.calculator.Sum(append([]string{manifest.Gemfile}, references...)...)
+	if err != nil {
+		return CacheKey{}, err
+	}
+
+	// without a lockfile, the Gemfile alone determines the installed gems
+	if manifest.Locked {
+		key.Lockfile, err = ip.calculator.Sum(manifest.Lockfile)
 		if err != nil {
-			return false, "", "", err
+			return CacheKey{}, err
 		}
 	}
 
-	var sum string
-	_, err = os.Stat(filepath.Join(workingDir, "Gemfile.lock"))
+	configPath := filepath.Join(workingDir, ".bundle", "config")
+	exists, err := pfs.Exists(configPath)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return false, "", "", err
+		return CacheKey{}, err
+	}
+
+	if exists {
+		key.BundleConfig, err = ip.calculator.Sum(configPath)
+		if err != nil {
+			return CacheKey{}, err
 		}
-	} else {
-		sum, err = ip.calculator.Sum(filepath.Join(workingDir, "Gemfile"), filepath.Join(workingDir, "Gemfile.lock"))
+	}
+
+	config, err := readBundleConfig(configPath)
+	if err != nil {
+		return CacheKey{}, err
+	}
+
+	cachePath := filepath.Join("vendor", "cache")
+	for _, variable := range settings.Environment {
+		if path, ok := strings.CutPrefix(variable, "BUNDLE_CACHE_PATH="); ok {
+			cachePath = path
+		}
+	}
+
+	// Bundler prefers the application's configuration over the environment
+	if path, ok := config["BUNDLE_CACHE_PATH"]; ok {
+		cachePath = path
+	}
+	if !filepath.IsAbs(cachePath) {
+		cachePath = filepath.Join(workingDir, cachePath)
+	}
+
+	gems, err := filepath.Glob(filepath.Join(cachePath, "*.gem"))
+	if err != nil {
+		return CacheKey{}, err
+	}
+
+	if len(gems) > 0 {
+		key.VendoredGems, err = ip.calculator.Sum(gems...)
 		if err != nil {
-			return false, "", "", err
+			return CacheKey{}, err
 		}
 	}
 
-	cachedSHA, ok := metadata["cache_sha"].(string)
-	cacheMatch := ok && cachedSHA == sum
-	shouldRun := !cacheMatch || !rubyVersionMatch
+	key.BundleEnvironment = checksumSettings(settings.Environment)
+	key.BuildpackConfig = checksumSettings(settingsFrom(settings))
 
-	return shouldRun, sum, rubyVersion, nil
+	return key, nil
 }
 
 // Execute will configure and install a set of gems into a layer location using
@@ -110,56 +235,40 @@ func (ip BundleInstallProcess) ShouldRun(metadata map[string]interface{}, workin
 // subsequent Bundle CLI commands. The configuration will then be modifed with
 // any settings specific to the invocation of Execute.  These configurations
 // will override any settings previously applied in the local Bundle
-// configuration.
+// configuration. A "gemfile" setting is additionally exported as
+// BUNDLE_GEMFILE while executing the Bundle CLI commands.
+//
+// When a download cache path is given, Execute points Bundler's user cache at it and
+// enables the global gem cache, so that the downloaded .gem files and the
+// compact index are kept there and only new gem versions are fetched.
 //
 // Once fully configured, Execute will run "bundle install" as a child process.
 // During the execution of the "bundle install" process, Execute will have
 // configured the command to use any locally vendored cache, enabling offline
 // execution.
-func (ip BundleInstallProcess) Execute(workingDir, layerPath string, config map[string]string, keepBuildFiles bool) error {
-	ip.logger.Debug.Subprocess("Setting up bundle install config paths:")
-
-	localConfigPath := filepath.Join(workingDir, ".bundle", "config")
-	backupConfigPath := filepath.Join(workingDir, ".bundle", "config.bak")
-	globalConfigPath := filepath.Join(layerPath, "config")
-
-	ip.logger.Debug.Subprocess("  Local config path: %s", localConfigPath)
-	ip.logger.Debug.Subprocess("  Backup config path: %s", backupConfigPath)
-	ip.logger.Debug.Subprocess("  Global config path: %s", globalConfigPath)
-
-	err := os.RemoveAll(globalConfigPath)
-	if err != nil {
-		return err
-	}
-
-	err = os.MkdirAll(layerPath, os.ModePerm)
+func (ip BundleInstallProcess) Execute(workingDir, layerPath, downloadCachePath string, config map[string]string, keepBuildFiles bool) error {
+	globalConfigPath, err := ip.setupConfig(workingDir, layerPath)
 	if err != nil {
 		return err
 	}
 
-	if _, err := os.Stat(localConfigPath); err == nil {
-		if _, err := os.Stat(backupConfigPath); err == nil {
-			err = pfs.Copy(backupConfigPath, localConfigPath)
-			if err != nil {
-				return err
-			}
-		}
-
-		err = pfs.Copy(localConfigPath, globalConfigPath)
-		if err != nil {
-			return err
-		}
-
-		err = pfs.Copy(localConfigPath, backupConfigPath)
-		if err != nil {
-			return err
-		}
-	}
-
 	ip.logger.Debug.Subprocess("Adding global config path to $BUNDLE_USER_CONFIG")
 	ip.logger.Debug.Break()
 	env := append(os.Environ(), fmt.Sprintf("BUNDLE_USER_CONFIG=%s", globalConfigPath))
 
+	// The local configuration takes precedence over the global configuration,
+	// so a configured Gemfile is also given as an environment variable to
+	// override any BUNDLE_GEMFILE setting in the local configuration.
+	if gemfile, ok := config["gemfile"]; ok {
+		env = append(env, fmt.Sprintf("BUNDLE_GEMFILE=%s", gemfile))
+	}
+
+	if downloadCachePath != "" {
+		ip.logger.Debug.Subprocess("Adding gem download cache path to $BUNDLE_USER_CACHE: %s", downloadCachePath)
+		ip.logger.Debug.Break()
+		env = append(env, fmt.Sprintf("BUNDLE_USER_CACHE=%s", downloadCachePath), "BUNDLE_GLOBAL_GEM_CACHE=true")
+	}
+
 	var keys []string
 	for key := range config {
 		keys = append(keys, key)
@@ -252,3 +361,61 @@ func (ip BundleInstallProcess) Execute(workingDir, layerPath string, config map[
 
 	return nil
 }
+
+// Configure writes the given settings into the global configuration of the
+// layer at the given path, as Execute would, without executing the Bundle CLI.
+// It is used when the gems of the layer are already installed, such as when
+// they were transferred from another layer that installed the same gems.
+func (ip BundleInstallProcess) Configure(workingDir, layerPath string, config map[string]string) error {
+	globalConfigPath, err := ip.setupConfig(workingDir, layerPath)
+	if err != nil {
+		return err
+	}
+
+	return writeBundleConfig(globalConfigPath, config)
+}
+
+// setupConfig prepares the global configuration of the layer at the given
+// path from the local configuration of the application, and returns its path.
+func (ip BundleInstallProcess) setupConfig(workingDir, layerPath string) (string, error) {
+	ip.logger.Debug.Subprocess("Setting up bundle install config paths:")
+
+	localConfigPath := filepath.Join(workingDir, ".bundle", "config")
+	backupConfigPath := filepath.Join(workingDir, ".bundle", "config.bak")
+	globalConfigPath := filepath.Join(layerPath, "config")
+
+	ip.logger.Debug.Subprocess("  Local config path: %s", localConfigPath)
+	ip.logger.Debug.Subprocess("  Backup config path: %s", backupConfigPath)
+	ip.logger.Debug.Subprocess("  Global config path: %s", globalConfigPath)
+
+	err := os.RemoveAll(globalConfigPath)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(layerPath, os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(localConfigPath); err == nil {
+		if _, err := os.Stat(backupConfigPath); err == nil {
+			err = pfs.Copy(backupConfigPath, localConfigPath)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		err = pfs.Copy(localConfigPath, globalConfigPath)
+		if err != nil {
+			return "", err
+		}
+
+		err = pfs.Copy(localConfigPath, backupConfigPath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return globalConfigPath, nil
+}
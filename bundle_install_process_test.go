@@ -11,6 +11,7 @@ import (
 
 	bundleinstall "github.com/paketo-buildpacks/bundle-install"
 	"github.com/paketo-buildpacks/bundle-install/fakes"
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
 	"github.com/paketo-buildpacks/packit/v2/pexec"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 	"github.com/sclevine/spec"
@@ -28,6 +29,8 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 		executable      *fakes.Executable
 		versionResolver *fakes.VersionResolver
 		calculator      *fakes.Calculator
+		gemfileParser   *fakes.GemfileReferenceParser
+		lockfileParser  *fakes.LockfileParser
 		buffer          *bytes.Buffer
 
 		installProcess bundleinstall.BundleInstallProcess
@@ -54,8 +57,10 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 		logEmitter := scribe.NewEmitter(buffer)
 		versionResolver = &fakes.VersionResolver{}
 		calculator = &fakes.Calculator{}
+		gemfileParser = &fakes.GemfileReferenceParser{}
+		lockfileParser = &fakes.LockfileParser{}
 
-		installProcess = bundleinstall.NewBundleInstallProcess(executable, logEmitter, versionResolver, calculator)
+		installProcess = bundleinstall.NewBundleInstallProcess(executable, logEmitter, versionResolver, calculator, gemfileParser, lockfileParser)
 	})
 
 	it.After(func() {
@@ -64,144 +69,485 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 	})
 
 	context("ShouldRun", func() {
-		it.Before(func() {
-			versionResolver.LookupCall.Returns.Version = "2.3.4"
-			versionResolver.CompareMajorMinorCall.Returns.Bool = true
+		var (
+			manifest bundleinstall.Manifest
+			metadata map[string]interface{}
+			abi      bundleinstall.RubyABI
+		)
 
-			calculator.SumCall.Returns.String = "other-checksum"
+		it.Before(func() {
+			manifest = bundleinstall.Manifest{
+				Gemfile:  filepath.Join(workingDir, "Gemfile"),
+				Lockfile: filepath.Join(workingDir, "Gemfile.lock"),
+				Locked:   true,
+			}
+
+			abi = bundleinstall.RubyABI{
+				Version:    "3.3.4",
+				ABIVersion: "3.3.0",
+				Platform:   "x86_64-linux",
+				Engine:     "ruby",
+				Shared:     "yes",
+				Libs:       "-lz -lrt -lrt -ldl -lcrypt -lm -lpthread",
+				YJIT:       "yes",
+			}
+			versionResolver.LookupCall.Returns.RubyABI = abi
+
+			calculator.SumCall.Stub = func(paths ...string) (string, error) {
+				return strings.Join(paths, ","), nil
+			}
+
+			metadata = map[string]interface{}{
+				"cache_key": map[string]interface{}{
+					"gemfile":            filepath.Join(workingDir, "Gemfile"),
+					"lockfile":           filepath.Join(workingDir, "Gemfile.lock"),
+					"bundle_config":      "",
+					"vendored_gems":      "",
+					"bundle_environment": "",
+					"buildpack_config":   "",
+				},
+				"ruby_version": "3.3.1",
+				"ruby_abi": map[string]interface{}{
+					"abi_version": "3.3.0",
+					"platform":    "x86_64-linux",
+					"engine":      "ruby",
+					"shared":      "yes",
+					"libs":        "-lz -lrt -lrt -ldl -lcrypt -lm -lpthread",
+					"yjit":        "yes",
+				},
+			}
 
 			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), nil, 0600)).To(Succeed())
 		})
 
-		it("indicates that the install process should run", func() {
-			ok, checksum, rubyVersion, err := installProcess.ShouldRun(map[string]interface{}{
-				"cache_sha":    "some-checksum",
-				"ruby_version": "1.2.3",
-			}, workingDir)
+		it("indicates that the install process should not run", func() {
+			reasons, key, rubyABI, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{})
 			Expect(err).NotTo(HaveOccurred())
-			Expect(ok).To(BeTrue())
-			Expect(checksum).To(Equal("other-checksum"))
-			Expect(rubyVersion).To(Equal("2.3.4"))
+			Expect(reasons).To(BeEmpty())
+			Expect(key).To(Equal(bundleinstall.CacheKey{
+				Gemfile:  filepath.Join(workingDir, "Gemfile"),
+				Lockfile: filepath.Join(workingDir, "Gemfile.lock"),
+			}))
+			Expect(rubyABI).To(Equal(abi))
 
 			Expect(versionResolver.LookupCall.CallCount).To(Equal(1))
-			Expect(versionResolver.CompareMajorMinorCall.Receives.Left).To(Equal("1.2.3"))
-			Expect(versionResolver.CompareMajorMinorCall.Receives.Right).To(Equal("2.3.4"))
+		})
 
-			Expect(calculator.SumCall.Receives.Paths).To(Equal([]string{
-				filepath.Join(workingDir, "Gemfile"),
-				filepath.Join(workingDir, "Gemfile.lock"),
-			}))
+		context("when there is no previous metadata", func() {
+			it("indicates that the install process should run", func() {
+				reasons, _, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reasons).To(Equal([]string{"no previous metadata"}))
+			})
+		})
+
+		context("when the layer metadata has no cache key", func() {
+			it.Before(func() {
+				delete(metadata, "cache_key")
+			})
+
+			it("indicates that the install process should run", func() {
+				reasons, _, _, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reasons).To(Equal([]string{"no previous cache key"}))
+			})
 		})
 
-		context("when the checksum matches, but the ruby version does not", func() {
+		context("when the layer metadata has no Ruby ABI", func() {
 			it.Before(func() {
-				versionResolver.LookupCall.Returns.Version = "2.3.4"
-				versionResolver.CompareMajorMinorCall.Returns.Bool = false
+				delete(metadata, "ruby_abi")
+			})
+
+			it("indicates that the install process should run", func() {
+				reasons, _, _, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reasons).To(Equal([]string{"no previous Ruby ABI"}))
+			})
+		})
 
-				calculator.SumCall.Returns.String = "some-checksum"
+		context("when the Ruby ABI version changed", func() {
+			it.Before(func() {
+				abi.Version = "3.4.1"
+				abi.ABIVersion = "3.4.0"
+				versionResolver.LookupCall.Returns.RubyABI = abi
 			})
 
 			it("indicates that the install process should run", func() {
-				ok, checksum, rubyVersion, err := installProcess.ShouldRun(map[string]interface{}{
-					"cache_sha":    "some-checksum",
-					"ruby_version": "1.2.3",
-				}, workingDir)
+				reasons, _, rubyABI, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{})
 				Expect(err).NotTo(HaveOccurred())
-				Expect(ok).To(BeTrue())
-				Expect(checksum).To(Equal("some-checksum"))
-				Expect(rubyVersion).To(Equal("2.3.4"))
+				Expect(reasons).To(Equal([]string{`Ruby ABI version changed from "3.3.0" to "3.4.0"`}))
+				Expect(rubyABI).To(Equal(abi))
 			})
 		})
 
-		context("when the checksum doesn't match, but the ruby version does", func() {
+		context("when the other Ruby ABI facts changed", func() {
 			it.Before(func() {
-				versionResolver.LookupCall.Returns.Version = "1.2.3"
-				versionResolver.CompareMajorMinorCall.Returns.Bool = true
+				versionResolver.LookupCall.Returns.RubyABI = bundleinstall.RubyABI{
+					Version:    "3.3.4",
+					ABIVersion: "3.3.0",
+					Platform:   "aarch64-linux",
+					Engine:     "truffleruby",
+					Shared:     "no",
+					Libs:       "-lz -lrt -lrt -ldl -lcrypt -lm -lpthread -ljemalloc",
+					YJIT:       "no",
+				}
+			})
+
+			it("indicates that the install process should run", func() {
+				reasons, _, _, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reasons).To(Equal([]string{
+					`Ruby platform changed from "x86_64-linux" to "aarch64-linux"`,
+					`Ruby engine changed from "ruby" to "truffleruby"`,
+					`Ruby shared library setting changed from "yes" to "no"`,
+					`Ruby linked libraries changed from "-lz -lrt -lrt -ldl -lcrypt -lm -lpthread" to "-lz -lrt -lrt -ldl -lcrypt -lm -lpthread -ljemalloc"`,
+					`Ruby YJIT support changed from "yes" to "no"`,
+				}))
+			})
+		})
+
+		context("when the user asks to rebuild on every Ruby patch release", func() {
+			it("indicates that the install process should run when the version changed", func() {
+				reasons, _, _, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{RebuildOnRubyPatch: true})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reasons).To(Equal([]string{"Ruby version changed from 3.3.1 to 3.3.4"}))
+			})
+
+			context("when the version is the same", func() {
+				it.Before(func() {
+					metadata["ruby_version"] = "3.3.4"
+				})
 
-				calculator.SumCall.Returns.String = "other-checksum"
+				it("indicates that the install process should not run", func() {
+					reasons, _, _, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{RebuildOnRubyPatch: true})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(reasons).To(BeEmpty())
+				})
+			})
+		})
+
+		context("when the Gemfile and Gemfile.lock changed", func() {
+			it.Before(func() {
+				metadata["cache_key"].(map[string]interface{})["gemfile"] = "other-checksum"
+				metadata["cache_key"].(map[string]interface{})["lockfile"] = "other-checksum"
 			})
 
 			it("indicates that the install process should run", func() {
-				ok, checksum, rubyVersion, err := installProcess.ShouldRun(map[string]interface{}{
-					"cache_sha":    "some-checksum",
-					"ruby_version": "1.2.3",
-				}, workingDir)
+				reasons, _, _, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{})
 				Expect(err).NotTo(HaveOccurred())
-				Expect(ok).To(BeTrue())
-				Expect(checksum).To(Equal("other-checksum"))
-				Expect(rubyVersion).To(Equal("1.2.3"))
+				Expect(reasons).To(Equal([]string{"Gemfile changed", "Gemfile.lock changed"}))
 			})
 		})
 
-		context("when the checksum and ruby version matches", func() {
+		context("when the app uses gems.rb and gems.locked", func() {
 			it.Before(func() {
-				versionResolver.LookupCall.Returns.Version = "1.2.3"
-				versionResolver.CompareMajorMinorCall.Returns.Bool = true
+				manifest = bundleinstall.Manifest{
+					Gemfile:  filepath.Join(workingDir, "gems.rb"),
+					Lockfile: filepath.Join(workingDir, "gems.locked"),
+					Locked:   true,
+				}
 
-				calculator.SumCall.Returns.String = "some-checksum"
+				Expect(os.WriteFile(filepath.Join(workingDir, "gems.locked"), nil, 0600)).To(Succeed())
 			})
 
-			it("indicates that the install process should not run", func() {
-				ok, checksum, rubyVersion, err := installProcess.ShouldRun(map[string]interface{}{
-					"cache_sha":    "some-checksum",
-					"ruby_version": "1.2.3",
-				}, workingDir)
+			it("checksums those files", func() {
+				reasons, key, _, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{})
 				Expect(err).NotTo(HaveOccurred())
-				Expect(ok).To(BeFalse())
-				Expect(checksum).To(Equal("some-checksum"))
-				Expect(rubyVersion).To(Equal("1.2.3"))
+				Expect(reasons).To(Equal([]string{"gems.rb changed", "gems.locked changed"}))
+				Expect(key.Gemfile).To(Equal(filepath.Join(workingDir, "gems.rb")))
+				Expect(key.Lockfile).To(Equal(filepath.Join(workingDir, "gems.locked")))
+			})
+		})
+
+		context("when the app has no Gemfile.lock", func() {
+			it.Before(func() {
+				manifest.Locked = false
+				Expect(os.Remove(filepath.Join(workingDir, "Gemfile.lock"))).To(Succeed())
+			})
+
+			it("checksums the Gemfile alone", func() {
+				reasons, key, _, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reasons).To(Equal([]string{"Gemfile.lock changed"}))
+				Expect(key.Gemfile).To(Equal(filepath.Join(workingDir, "Gemfile")))
+				Expect(key.Lockfile).To(BeEmpty())
+			})
+		})
+
+		context("when the other cache key components changed", func() {
+			it.Before(func() {
+				Expect(os.Mkdir(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config"), nil, 0600)).To(Succeed())
+
+				Expect(os.MkdirAll(filepath.Join(workingDir, "vendor", "cache"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "vendor", "cache", "rack-3.0.8.gem"), nil, 0600)).To(Succeed())
+			})
+
+			it("indicates that the install process should run", func() {
+				reasons, _, _, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{
+					Config:      map[string]string{"path": "some-path"},
+					Environment: []string{"BUNDLE_JOBS=4"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reasons).To(Equal([]string{
+					".bundle/config changed",
+					"vendored gems changed",
+					"BUNDLE_* environment variables changed",
+					"configuration changed",
+				}))
+			})
+		})
+
+		context("when only the gem groups changed", func() {
+			it("leaves them to be reported by the caller", func() {
+				_, key, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{
+					Config: map[string]string{"path": "some-path", "without": "development:test"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				metadata["cache_key"] = key.Metadata()
+				reasons, _, _, err := installProcess.ShouldRun(metadata, workingDir, manifest, bundleinstall.InstallSettings{
+					Config: map[string]string{"path": "some-path", "without": "development", "with": "assets"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reasons).To(BeEmpty())
+			})
+		})
+
+		context("cache key components", func() {
+			it.Before(func() {
+				calculator.SumCall.Stub = func(paths ...string) (string, error) {
+					return strings.Join(paths, ","), nil
+				}
+			})
+
+			context("when the app has a .bundle/config", func() {
+				it.Before(func() {
+					Expect(os.Mkdir(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("BUNDLE_BUILD__NOKOGIRI: \"--use-system-libraries\"\n"), 0600)).To(Succeed())
+				})
+
+				it("checksums the config", func() {
+					_, key, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key.BundleConfig).To(Equal(filepath.Join(workingDir, ".bundle", "config")))
+				})
+			})
+
+			context("when the app vendors gems", func() {
+				it.Before(func() {
+					Expect(os.MkdirAll(filepath.Join(workingDir, "vendor", "cache"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "vendor", "cache", "rack-3.0.8.gem"), nil, 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "vendor", "cache", "puma-6.4.0.gem"), nil, 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "vendor", "cache", "README"), nil, 0600)).To(Succeed())
+				})
+
+				it("checksums the .gem files", func() {
+					_, key, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key.VendoredGems).To(Equal(strings.Join([]string{
+						filepath.Join(workingDir, "vendor", "cache", "puma-6.4.0.gem"),
+						filepath.Join(workingDir, "vendor", "cache", "rack-3.0.8.gem"),
+					}, ",")))
+				})
+			})
+
+			context("when the .bundle/config sets the cache path", func() {
+				it.Before(func() {
+					Expect(os.Mkdir(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("BUNDLE_CACHE_PATH: \"gems\"\n"), 0600)).To(Succeed())
+
+					Expect(os.MkdirAll(filepath.Join(workingDir, "gems"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "gems", "rack-3.0.8.gem"), nil, 0600)).To(Succeed())
+				})
+
+				it("checksums the .gem files in that directory", func() {
+					_, key, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key.VendoredGems).To(Equal(filepath.Join(workingDir, "gems", "rack-3.0.8.gem")))
+				})
+
+				context("when BUNDLE_CACHE_PATH is also set in the environment", func() {
+					it.Before(func() {
+						Expect(os.MkdirAll(filepath.Join(workingDir, "other"), os.ModePerm)).To(Succeed())
+						Expect(os.WriteFile(filepath.Join(workingDir, "other", "puma-6.4.0.gem"), nil, 0600)).To(Succeed())
+					})
+
+					it("prefers the .bundle/config, as Bundler does", func() {
+						_, key, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{
+							Environment: []string{"BUNDLE_CACHE_PATH=other"},
+						})
+						Expect(err).NotTo(HaveOccurred())
+						Expect(key.VendoredGems).To(Equal(filepath.Join(workingDir, "gems", "rack-3.0.8.gem")))
+					})
+				})
+			})
+
+			context("when the environment sets the cache path", func() {
+				it.Before(func() {
+					Expect(os.MkdirAll(filepath.Join(workingDir, "other"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "other", "puma-6.4.0.gem"), nil, 0600)).To(Succeed())
+				})
+
+				it("checksums the .gem files in that directory", func() {
+					_, key, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{
+						Environment: []string{"BUNDLE_CACHE_PATH=other"},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key.VendoredGems).To(Equal(filepath.Join(workingDir, "other", "puma-6.4.0.gem")))
+				})
+			})
+
+			context("when the Gemfile refers to other files", func() {
+				it.Before(func() {
+					gemfileParser.ParseReferencesCall.Returns.GemfileReferences = bundleinstall.GemfileReferences{
+						EvalGemfiles: []string{filepath.Join(workingDir, "Gemfile.shared")},
+						Paths:        []string{workingDir, filepath.Join(workingDir, "engines", "billing")},
+					}
+					lockfileParser.ParseCall.Returns.Lockfile = lockfile.Lockfile{
+						Sources: []lockfile.Source{
+							{Type: lockfile.SourceTypePath, Remotes: []string{"components/search"}},
+							{Type: lockfile.SourceTypePath, Remotes: []string{"engines/billing"}},
+						},
+					}
+
+					Expect(os.WriteFile(filepath.Join(workingDir, "app.gemspec"), nil, 0600)).To(Succeed())
+
+					Expect(os.MkdirAll(filepath.Join(workingDir, "engines", "billing"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "engines", "billing", "billing.gemspec"), nil, 0600)).To(Succeed())
+
+					Expect(os.MkdirAll(filepath.Join(workingDir, "components", "search"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "components", "search", "search.gemspec"), nil, 0600)).To(Succeed())
+				})
+
+				it("checksums the evaluated Gemfiles and the gemspecs of path gems", func() {
+					_, key, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key.Gemfile).To(Equal(strings.Join([]string{
+						filepath.Join(workingDir, "Gemfile"),
+						filepath.Join(workingDir, "Gemfile.shared"),
+						filepath.Join(workingDir, "app.gemspec"),
+						filepath.Join(workingDir, "engines", "billing", "billing.gemspec"),
+						filepath.Join(workingDir, "components", "search", "search.gemspec"),
+					}, ",")))
+
+					Expect(gemfileParser.ParseReferencesCall.Receives.Path).To(Equal(filepath.Join(workingDir, "Gemfile")))
+					Expect(lockfileParser.ParseCall.Receives.Path).To(Equal(filepath.Join(workingDir, "Gemfile.lock")))
+				})
+			})
+
+			context("when there is no lockfile", func() {
+				it.Before(func() {
+					manifest.Locked = false
+				})
+
+				it("does not parse it for path gems", func() {
+					_, _, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(lockfileParser.ParseCall.CallCount).To(Equal(0))
+				})
+			})
+
+			context("when settings are given", func() {
+				it("checksums them regardless of their order", func() {
+					_, key, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{
+						Config:      map[string]string{"path": "some-path", "clean": "true"},
+						Environment: []string{"BUNDLE_JOBS=4", "BUNDLE_RETRY=3"},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key.BundleEnvironment).NotTo(BeEmpty())
+					Expect(key.BuildpackConfig).NotTo(BeEmpty())
+
+					_, otherKey, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{
+						Config:      map[string]string{"clean": "true", "path": "some-path"},
+						Environment: []string{"BUNDLE_RETRY=3", "BUNDLE_JOBS=4"},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(otherKey).To(Equal(key))
+
+					_, otherKey, _, err = installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{
+						Config:         map[string]string{"clean": "true", "path": "some-path"},
+						KeepBuildFiles: true,
+						Environment:    []string{"BUNDLE_RETRY=3", "BUNDLE_JOBS=4"},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(otherKey.BuildpackConfig).NotTo(Equal(key.BuildpackConfig))
+					Expect(otherKey.BundleEnvironment).To(Equal(key.BundleEnvironment))
+				})
 			})
 		})
 
 		context("failure cases", func() {
 			context("when the ruby version cannot be looked up", func() {
 				it.Before(func() {
-					versionResolver.LookupCall.Returns.Err = errors.New("failed to lookup ruby version")
+					versionResolver.LookupCall.Returns.Error = errors.New("failed to lookup ruby version")
 				})
 
 				it("returns an error", func() {
 					_, _, _, err := installProcess.ShouldRun(map[string]interface{}{
-						"cache_sha":    "some-checksum",
+						"cache_key": map[string]interface{}{
+							"gemfile":            "some-checksum",
+							"bundle_config":      "",
+							"vendored_gems":      "",
+							"bundle_environment": "",
+							"buildpack_config":   "",
+						},
 						"ruby_version": "1.2.3",
-					}, workingDir)
+					}, workingDir, manifest, bundleinstall.InstallSettings{})
 					Expect(err).To(MatchError("failed to lookup ruby version"))
 				})
 			})
 
-			context("when the ruby version cannot be compared", func() {
+			context("when the .bundle/config cannot be parsed", func() {
 				it.Before(func() {
-					versionResolver.CompareMajorMinorCall.Returns.Error = errors.New("failed to compare ruby version")
+					Expect(os.Mkdir(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("%%%"), 0600)).To(Succeed())
 				})
 
 				it("returns an error", func() {
-					_, _, _, err := installProcess.ShouldRun(map[string]interface{}{
-						"cache_sha":    "some-checksum",
-						"ruby_version": "1.2.3",
-					}, workingDir)
-					Expect(err).To(MatchError("failed to compare ruby version"))
+					_, _, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse bundle config")))
 				})
 			})
 
-			context("when the Gemfile.lock cannot be stat'd", func() {
+			context("when a path gem is outside of the application directory", func() {
 				it.Before(func() {
-					Expect(os.Chmod(workingDir, 0000)).To(Succeed())
+					gemfileParser.ParseReferencesCall.Returns.GemfileReferences = bundleinstall.GemfileReferences{
+						Paths: []string{filepath.Join(filepath.Dir(workingDir), "billing")},
+					}
 				})
 
-				it.After(func() {
-					Expect(os.Chmod(workingDir, os.ModePerm)).To(Succeed())
+				it("returns an error", func() {
+					_, _, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{})
+					Expect(err).To(MatchError(fmt.Sprintf("failed to locate path gem: %s is outside of the application directory %s and does not exist in the build container, move the gem into the application directory", filepath.Join(filepath.Dir(workingDir), "billing"), workingDir)))
+				})
+			})
+
+			context("when the Gemfile.lock cannot be parsed", func() {
+				it.Before(func() {
+					lockfileParser.ParseCall.Returns.Error = errors.New("failed to parse Gemfile.lock")
 				})
 
 				it("returns an error", func() {
-					_, _, _, err := installProcess.ShouldRun(map[string]interface{}{
-						"cache_sha":    "some-checksum",
-						"ruby_version": "1.2.3",
-					}, workingDir)
-					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+					_, _, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{})
+					Expect(err).To(MatchError("failed to parse Gemfile.lock"))
+				})
+			})
+
+			context("when the Gemfile cannot be parsed", func() {
+				it.Before(func() {
+					gemfileParser.ParseReferencesCall.Returns.Error = errors.New("failed to parse Gemfile")
+				})
+
+				it("returns an error", func() {
+					_, _, _, err := installProcess.ShouldRun(nil, workingDir, manifest, bundleinstall.InstallSettings{})
+					Expect(err).To(MatchError("failed to parse Gemfile"))
 				})
 			})
 
 			context("when a checksum cannot be calculated", func() {
 				it.Before(func() {
+					calculator.SumCall.Stub = nil
 					calculator.SumCall.Returns.Error = errors.New("failed to calculate checksum")
 				})
 
@@ -211,9 +557,15 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 
 				it("returns an error", func() {
 					_, _, _, err := installProcess.ShouldRun(map[string]interface{}{
-						"cache_sha":    "some-checksum",
+						"cache_key": map[string]interface{}{
+							"gemfile":            "some-checksum",
+							"bundle_config":      "",
+							"vendored_gems":      "",
+							"bundle_environment": "",
+							"buildpack_config":   "",
+						},
 						"ruby_version": "1.2.3",
-					}, workingDir)
+					}, workingDir, manifest, bundleinstall.InstallSettings{})
 					Expect(err).To(MatchError("failed to calculate checksum"))
 				})
 			})
@@ -223,7 +575,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 	context("Execute", func() {
 		context("when there is no vendor/cache directory present", func() {
 			it("runs the bundle install process", func() {
-				err := installProcess.Execute(workingDir, layerPath, map[string]string{"path": "some-dir"}, false)
+				err := installProcess.Execute(workingDir, layerPath, "", map[string]string{"path": "some-dir"}, false)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(executions).To(HaveLen(3))
@@ -245,7 +597,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("runs the bundle install process", func() {
-				err := installProcess.Execute(workingDir, layerPath, map[string]string{"clean": "true"}, false)
+				err := installProcess.Execute(workingDir, layerPath, "", map[string]string{"clean": "true"}, false)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(executions).To(HaveLen(3))
@@ -271,7 +623,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("runs the bundle install process", func() {
-				err := installProcess.Execute(workingDir, layerPath, map[string]string{
+				err := installProcess.Execute(workingDir, layerPath, "", map[string]string{
 					"without": "development:test",
 				}, false)
 				Expect(err).NotTo(HaveOccurred())
@@ -283,6 +635,32 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("when the gemfile is configured", func() {
+			it("exports it as BUNDLE_GEMFILE", func() {
+				err := installProcess.Execute(workingDir, layerPath, "", map[string]string{"gemfile": "/some/Gemfile.next"}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(3))
+				Expect(executions[0].Args).To(Equal([]string{"config", "--global", "gemfile", "/some/Gemfile.next"}))
+				for _, execution := range executions {
+					Expect(execution.Env).To(ContainElement("BUNDLE_GEMFILE=/some/Gemfile.next"))
+				}
+			})
+		})
+
+		context("when a download cache path is given", func() {
+			it("points the Bundler user cache at it", func() {
+				err := installProcess.Execute(workingDir, layerPath, "/some/gem-cache", nil, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(2))
+				for _, execution := range executions {
+					Expect(execution.Env).To(ContainElement("BUNDLE_USER_CACHE=/some/gem-cache"))
+					Expect(execution.Env).To(ContainElement("BUNDLE_GLOBAL_GEM_CACHE=true"))
+				}
+			})
+		})
+
 		context("when there is local bundle config", func() {
 			it.Before(func() {
 				Expect(os.Mkdir(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
@@ -290,7 +668,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("copies that config into the global config", func() {
-				err := installProcess.Execute(workingDir, layerPath, nil, false)
+				err := installProcess.Execute(workingDir, layerPath, "", nil, false)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(executions).To(HaveLen(2))
@@ -303,7 +681,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("makes a backup of that local config", func() {
-				err := installProcess.Execute(workingDir, layerPath, nil, false)
+				err := installProcess.Execute(workingDir, layerPath, "", nil, false)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(executions).To(HaveLen(2))
@@ -321,7 +699,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 				})
 
 				it("replaces the local config with the backup", func() {
-					err := installProcess.Execute(workingDir, layerPath, nil, false)
+					err := installProcess.Execute(workingDir, layerPath, "", nil, false)
 					Expect(err).NotTo(HaveOccurred())
 
 					Expect(executions).To(HaveLen(2))
@@ -356,7 +734,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("cleans them up", func() {
-				err := installProcess.Execute(workingDir, layerPath, nil, false)
+				err := installProcess.Execute(workingDir, layerPath, "", nil, false)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(filepath.Join(path, "some-gem", "some-gem.gem")).To(BeAnExistingFile())
@@ -369,7 +747,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 
 			context("when the BP_KEEP_GEM_EXTENSION_BUILD_FILES env var is set", func() {
 				it("leaves those files in place", func() {
-					err := installProcess.Execute(workingDir, layerPath, nil, true)
+					err := installProcess.Execute(workingDir, layerPath, "", nil, true)
 					Expect(err).NotTo(HaveOccurred())
 
 					Expect(filepath.Join(path, "some-gem", "some-gem.gem")).To(BeAnExistingFile())
@@ -390,7 +768,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 				})
 
 				it("returns an error", func() {
-					err := installProcess.Execute(workingDir, layerPath, nil, false)
+					err := installProcess.Execute(workingDir, layerPath, "", nil, false)
 					Expect(err).To(MatchError(ContainSubstring("permission denied")))
 				})
 			})
@@ -412,7 +790,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 				})
 
 				it("prints the execution output and returns an error", func() {
-					err := installProcess.Execute(workingDir, layerPath, map[string]string{"path": "some-dir"}, false)
+					err := installProcess.Execute(workingDir, layerPath, "", map[string]string{"path": "some-dir"}, false)
 					Expect(err).To(MatchError(ContainSubstring("failed to execute bundle config")))
 					Expect(err).To(MatchError(ContainSubstring("bundle config path failed")))
 				})
@@ -428,7 +806,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 				})
 
 				it("runs the bundle install process", func() {
-					err := installProcess.Execute(workingDir, layerPath, map[string]string{"path": "some-dir"}, false)
+					err := installProcess.Execute(workingDir, layerPath, "", map[string]string{"path": "some-dir"}, false)
 					Expect(err).To(MatchError(ContainSubstring("permission denied")))
 				})
 			})
@@ -450,7 +828,7 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 				})
 
 				it("prints the execution output and returns an error", func() {
-					err := installProcess.Execute(workingDir, layerPath, map[string]string{"path": "some-dir"}, false)
+					err := installProcess.Execute(workingDir, layerPath, "", map[string]string{"path": "some-dir"}, false)
 					Expect(err).To(MatchError(ContainSubstring("failed to execute bundle install")))
 					Expect(err).To(MatchError(ContainSubstring("bundle install failed")))
 				})
@@ -471,11 +849,53 @@ func testBundleInstallProcess(t *testing.T, context spec.G, it spec.S) {
 				})
 
 				it("returns an error", func() {
-					err := installProcess.Execute(workingDir, layerPath, nil, false)
+					err := installProcess.Execute(workingDir, layerPath, "", nil, false)
 					Expect(err).To(MatchError(ContainSubstring("failed to cleanup gem extension build files")))
 					Expect(err).To(MatchError(ContainSubstring("permission denied")))
 				})
 			})
 		})
 	})
+
+	context("Configure", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("---\nBUNDLE_JOBS: \"4\"\nBUNDLE_WITHOUT: \"assets\"\n"), 0600)).To(Succeed())
+		})
+
+		it("writes the settings into the layer config without running bundler", func() {
+			err := installProcess.Configure(workingDir, layerPath, map[string]string{
+				"path":                filepath.Join(layerPath, "gems"),
+				"without":             "development:test",
+				"force_ruby_platform": "true",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(executions).To(BeEmpty())
+
+			content, err := os.ReadFile(filepath.Join(layerPath, "config"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(fmt.Sprintf(`---
+BUNDLE_FORCE_RUBY_PLATFORM: "true"
+BUNDLE_JOBS: "4"
+BUNDLE_PATH: %q
+BUNDLE_WITHOUT: "development:test"
+`, filepath.Join(layerPath, "gems"))))
+
+			Expect(filepath.Join(workingDir, ".bundle", "config.bak")).To(BeAnExistingFile())
+		})
+
+		context("failure cases", func() {
+			context("when the local config cannot be parsed", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("%%%"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					err := installProcess.Configure(workingDir, layerPath, map[string]string{"path": "some-dir"})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse bundle config")))
+				})
+			})
+		})
+	})
 }
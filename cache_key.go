@@ -0,0 +1,130 @@
+package bundleinstall
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// InstallSettings are the settings, other than the files of the application,
+// under which gems are installed into a layer.
+type InstallSettings struct {
+	// Config is the Bundler configuration given by the buildpack.
+	Config map[string]string
+
+	// KeepBuildFiles is true when gem extension build files are kept.
+	KeepBuildFiles bool
+
+	// Environment is the set of BUNDLE_* environment variables, in the form
+	// "NAME=value".
+	Environment []string
+
+	// RebuildOnRubyPatch is true when gems are to be reinstalled whenever the
+	// version of Ruby changes, rather than only when its ABI changes.
+	RebuildOnRubyPatch bool
+}
+
+// CacheKey identifies the inputs of a gem installation. Each component is a
+// checksum of one kind of input, so that a change can be traced back to it.
+// A component is empty when there is no such input.
+type CacheKey struct {
+	// Gemfile is the checksum of the Gemfile, along with the Gemfiles it
+	// evaluates and the gemspecs of path gems.
+	Gemfile string
+
+	// Lockfile is the checksum of the lockfile.
+	Lockfile string
+
+	// BundleConfig is the checksum of the application's .bundle/config.
+	BundleConfig string
+
+	// VendoredGems is the checksum of the .gem files in the Bundler cache
+	// directory of the application.
+	VendoredGems string
+
+	// BundleEnvironment is the checksum of the BUNDLE_* environment variables.
+	BundleEnvironment string
+
+	// BuildpackConfig is the checksum of the configuration given by the
+	// buildpack.
+	BuildpackConfig string
+}
+
+// components returns the names and values of the components of the key, in
+// the order they are declared.
+func (k CacheKey) components() [][2]string {
+	return [][2]string{
+		{"gemfile", k.Gemfile},
+		{"lockfile", k.Lockfile},
+		{"bundle_config", k.BundleConfig},
+		{"vendored_gems", k.VendoredGems},
+		{"bundle_environment", k.BundleEnvironment},
+		{"buildpack_config", k.BuildpackConfig},
+	}
+}
+
+// Metadata returns the components of the key, by name, to be stored in the
+// layer metadata.
+func (k CacheKey) Metadata() map[string]interface{} {
+	metadata := map[string]interface{}{}
+	for _, component := range k.components() {
+		metadata[component[0]] = component[1]
+	}
+
+	return metadata
+}
+
+// Changed returns the names of the components that differ from the given
+// metadata, as stored by a previous build, in the order they are declared.
+// Every component has changed when there is no such metadata.
+func (k CacheKey) Changed(metadata interface{}) []string {
+	cached, _ := metadata.(map[string]interface{})
+
+	var changed []string
+	for _, component := range k.components() {
+		value, ok := cached[component[0]].(string)
+		if !ok || value != component[1] {
+			changed = append(changed, component[0])
+		}
+	}
+
+	return changed
+}
+
+// checksumSettings returns a checksum of the given settings, which does not
+// depend on their order, or an empty string when there are none.
+func checksumSettings(settings []string) string {
+	if len(settings) == 0 {
+		return ""
+	}
+
+	sorted := append([]string(nil), settings...)
+	sort.Strings(sorted)
+
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// settingsFrom returns the given Bundler configuration as "key=value"
+// settings, along with whether extension build files are kept. The group
+// selection is left out, as changes to it are tracked by the layer metadata
+// and reported on their own.
+func settingsFrom(settings InstallSettings) []string {
+	var lines []string
+	for key, value := range settings.Config {
+		if slices.Contains(groupConfigKeys, key) {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	if settings.KeepBuildFiles {
+		lines = append(lines, "keep_gem_extension_build_files=true")
+	}
+
+	return lines
+}
@@ -0,0 +1,69 @@
+package bundleinstall_test
+
+import (
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testCacheKey(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		key bundleinstall.CacheKey
+	)
+
+	it.Before(func() {
+		key = bundleinstall.CacheKey{
+			Gemfile:           "gemfile-checksum",
+			Lockfile:          "lockfile-checksum",
+			BundleConfig:      "bundle-config-checksum",
+			VendoredGems:      "",
+			BundleEnvironment: "bundle-environment-checksum",
+			BuildpackConfig:   "buildpack-config-checksum",
+		}
+	})
+
+	context("Metadata", func() {
+		it("returns each component by name", func() {
+			Expect(key.Metadata()).To(Equal(map[string]interface{}{
+				"gemfile":            "gemfile-checksum",
+				"lockfile":           "lockfile-checksum",
+				"bundle_config":      "bundle-config-checksum",
+				"vendored_gems":      "",
+				"bundle_environment": "bundle-environment-checksum",
+				"buildpack_config":   "buildpack-config-checksum",
+			}))
+		})
+	})
+
+	context("Changed", func() {
+		it("returns nothing when the metadata matches", func() {
+			Expect(key.Changed(key.Metadata())).To(BeEmpty())
+		})
+
+		it("returns the components that differ, in the order they are declared", func() {
+			Expect(key.Changed(map[string]interface{}{
+				"gemfile":            "gemfile-checksum",
+				"lockfile":           "lockfile-checksum",
+				"bundle_config":      "other-checksum",
+				"vendored_gems":      "other-checksum",
+				"bundle_environment": "bundle-environment-checksum",
+			})).To(Equal([]string{"bundle_config", "vendored_gems", "buildpack_config"}))
+		})
+
+		it("returns every component when there is no metadata", func() {
+			Expect(key.Changed(nil)).To(Equal([]string{
+				"gemfile",
+				"lockfile",
+				"bundle_config",
+				"vendored_gems",
+				"bundle_environment",
+				"buildpack_config",
+			}))
+		})
+	})
+}
@@ -13,6 +13,15 @@ const (
 	// build plan entries.
 	MRIDependency = "mri"
 
+	// JRubyDependency is the name of a dependency required by the buildpack in
+	// its build plan entries when the Gemfile declares the JRuby engine.
+	JRubyDependency = "jruby"
+
+	// TruffleRubyDependency is the name of a dependency required by the
+	// buildpack in its build plan entries when the Gemfile declares the
+	// TruffleRuby engine.
+	TruffleRubyDependency = "truffleruby"
+
 	// LayerNameBuildGems is the name of the layer that is used to store gems
 	// that are available during the build phase.
 	LayerNameBuildGems = "build-gems"
@@ -20,4 +29,12 @@ const (
 	// LayerNameLaunchGems is the name of the layer that is used to store gems
 	// that are available during the launch phase.
 	LayerNameLaunchGems = "launch-gems"
+
+	// LayerNameGemCache is the name of the cache-only layer that is used to
+	// store the gems and compact index downloaded by Bundler.
+	LayerNameGemCache = "gem-cache"
+
+	// LayerNameGitCache is the name of the cache-only layer that is used to
+	// store the clones of git sources made by Bundler.
+	LayerNameGitCache = "git-cache"
 )
@@ -2,14 +2,19 @@ package bundleinstall
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 )
 
 //go:generate faux --interface VersionParser --output fakes/version_parser.go
+//go:generate faux --interface GemfileVersionParser --output fakes/gemfile_version_parser.go
+//go:generate faux --interface LockfileParser --output fakes/lockfile_parser.go
 
 // VersionParser defines the interface for parsing the version of Ruby used by
 // the application.
@@ -17,6 +22,19 @@ type VersionParser interface {
 	ParseVersion(path string) (version string, err error)
 }
 
+// GemfileVersionParser defines the interface for parsing the version and
+// engine of Ruby declared in the Gemfile of the application.
+type GemfileVersionParser interface {
+	VersionParser
+	ParseEngine(path string) (engine, engineVersion string, err error)
+}
+
+// LockfileParser defines the interface for parsing the Gemfile.lock of the
+// application.
+type LockfileParser interface {
+	Parse(path string) (lockfile.Lockfile, error)
+}
+
 // BuildPlanMetadata declares the set of metadata included in buildplan
 // requirements.
 type BuildPlanMetadata struct {
@@ -26,39 +44,113 @@ type BuildPlanMetadata struct {
 	Launch        bool   `toml:"launch"`
 }
 
-const rubyVersionFile = ".ruby-version"
-
 // Detect will return a packit.DetectFunc that will be invoked during the
 // detect phase of the buildpack lifecycle.
 //
 // Detect will return a positive result if the application source code contains
-// a Gemfile.
+// a Gemfile, or its gems.rb equivalent. The location of the Gemfile can be
+// configured with $BP_BUNDLE_GEMFILE or BUNDLE_GEMFILE in .bundle/config.
 //
 // The buildplan entries for a positive detection include providing the "gems"
-// dependency, and requiring the "bundler" and "mri" dependencies. If the
-// Gemfile contains a specified Ruby version, the "mri" build plan entry will
-// include a specific Ruby version contraint.
-func Detect(gemfileParser, rubyVersionFileParser VersionParser, logger scribe.Emitter) packit.DetectFunc {
+// dependency, and requiring the "bundler" and "mri" dependencies. The "mri"
+// build plan entry includes the Ruby version constraint selected by
+// ResolveRubyVersion from the Gemfile, the .ruby-version, .tool-versions,
+// mise.toml and .mise.toml files in the app directory and the RUBY VERSION
+// section of the Gemfile.lock. Sources that conflict with the selected version
+// are logged as warnings or, when $BP_RUBY_VERSION_STRICT is set, fail
+// detection.
+//
+// If the Gemfile ruby directive declares an alternative engine, such as
+// `engine: "jruby"`, the "jruby" or "truffleruby" dependency is required in
+// place of "mri", constrained to the declared engine_version. Detection fails
+// for engines that no buildpack provides.
+//
+// If the Gemfile.lock lists a BUNDLED WITH version, the "bundler" build plan
+// entry will include a version constraint derived from it according to the
+// configured BundlerVersionPolicy.
+func Detect(gemfileParser GemfileVersionParser, rubyVersionFileParser VersionParser, lockfileParser LockfileParser, logger scribe.Emitter, environment Environment) packit.DetectFunc {
 	return func(context packit.DetectContext) (packit.DetectResult, error) {
-		mriVersion, err := gemfileParser.ParseVersion(filepath.Join(context.WorkingDir, "Gemfile"))
+		manifest, err := LocateManifest(context.WorkingDir, environment.Gemfile, environment.BundleGemfile)
 		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				return packit.DetectResult{}, packit.Fail.WithMessage("Gemfile is not present")
+			return packit.DetectResult{}, err
+		}
+
+		gemfileVersion, err := gemfileParser.ParseVersion(manifest.Gemfile)
+		if err != nil {
+			// the missing file may instead be one that the Gemfile refers to, such
+			// as that of its ruby file: directive
+			if _, statErr := os.Stat(manifest.Gemfile); errors.Is(err, os.ErrNotExist) && errors.Is(statErr, os.ErrNotExist) {
+				return packit.DetectResult{}, packit.Fail.WithMessage("%s is not present", filepath.Base(manifest.Gemfile))
 			}
 			return packit.DetectResult{}, err
 		}
-		var versionSource string
-		if mriVersion != "" {
-			versionSource = "Gemfile"
+
+		engine, engineVersion, err := gemfileParser.ParseEngine(manifest.Gemfile)
+		if err != nil {
+			return packit.DetectResult{}, err
+		}
+
+		rubyDependency := MRIDependency
+		switch engine {
+		case "", "ruby":
+		case JRubyDependency, TruffleRubyDependency:
+			rubyDependency = engine
+		default:
+			return packit.DetectResult{}, packit.Fail.WithMessage("%s requires the %q Ruby engine, which is not provided by any buildpack: use one of %q, %q or %q", filepath.Base(manifest.Gemfile), engine, "ruby", JRubyDependency, TruffleRubyDependency)
+		}
+
+		lock, err := lockfileParser.Parse(manifest.Lockfile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return packit.DetectResult{}, err
+		}
+
+		var rubyVersion, versionSource string
+		if rubyDependency != MRIDependency {
+			// the engine version, rather than the Ruby language version, selects
+			// the version of an alternative engine
+			rubyVersion = engineVersion
+			if rubyVersion != "" {
+				versionSource = filepath.Base(manifest.Gemfile)
+			}
 		} else {
-			// fall back to .ruby-version file
-			rubyVersion, err := rubyVersionFileParser.ParseVersion(rubyVersionFile)
-			if err != nil {
-				logger.Subprocess("WARNING: Could not parse the .ruby-version file, as a result no Ruby version has been specified")
-			} else if rubyVersion != "" {
-				mriVersion = rubyVersion
-				versionSource = rubyVersionFile
+			candidates := []RubyVersionCandidate{
+				{Version: gemfileVersion, Source: filepath.Base(manifest.Gemfile)},
+			}
+
+			for _, file := range rubyVersionFiles {
+				fileVersion, err := rubyVersionFileParser.ParseVersion(filepath.Join(context.WorkingDir, file))
+				if err != nil {
+					if !errors.Is(err, os.ErrNotExist) {
+						logger.Subprocess("WARNING: Could not parse the %s file: %s", file, err)
+					}
+					continue
+				}
+
+				candidates = append(candidates, RubyVersionCandidate{Version: fileVersion, Source: file})
+			}
+
+			// the patchlevel of the Gemfile.lock RUBY VERSION is ignored as it is
+			// not part of the version constraint
+			if lock.RubyVersion.Engine == "" {
+				candidates = append(candidates, RubyVersionCandidate{Version: lock.RubyVersion.Version, Source: filepath.Base(manifest.Lockfile)})
 			}
+
+			selected, conflicts := ResolveRubyVersion(candidates)
+			for _, conflict := range conflicts {
+				if environment.RubyVersionStrict {
+					return packit.DetectResult{}, packit.Fail.WithMessage("%s: make the Ruby versions agree or unset $BP_RUBY_VERSION_STRICT", conflict)
+				}
+
+				logger.Subprocess("WARNING: %s, using the version from %s", conflict, selected.Source)
+			}
+
+			rubyVersion, versionSource = selected.Version, selected.Source
+		}
+
+		var bundlerVersion, bundlerVersionSource string
+		if environment.BundlerVersionPolicy != BundlerVersionPolicyNone && lock.BundledWith != "" {
+			bundlerVersion = bundlerVersionConstraint(lock.BundledWith, environment.BundlerVersionPolicy)
+			bundlerVersionSource = filepath.Base(manifest.Lockfile)
 		}
 
 		return packit.DetectResult{
@@ -70,13 +162,15 @@ func Detect(gemfileParser, rubyVersionFileParser VersionParser, logger scribe.Em
 					{
 						Name: BundlerDependency,
 						Metadata: BuildPlanMetadata{
-							Build: true,
+							Version:       bundlerVersion,
+							VersionSource: bundlerVersionSource,
+							Build:         true,
 						},
 					},
 					{
-						Name: MRIDependency,
+						Name: rubyDependency,
 						Metadata: BuildPlanMetadata{
-							Version:       mriVersion,
+							Version:       rubyVersion,
 							VersionSource: versionSource,
 							Build:         true,
 						},
@@ -86,3 +180,16 @@ func Detect(gemfileParser, rubyVersionFileParser VersionParser, logger scribe.Em
 		}, nil
 	}
 }
+
+// bundlerVersionConstraint converts the BUNDLED WITH version into a version
+// constraint for the given policy. The major policy uses a single-segment
+// pessimistic constraint (~> 2) as it has the same meaning in both RubyGems
+// and semver notation.
+func bundlerVersionConstraint(version, policy string) string {
+	if policy == BundlerVersionPolicyExact {
+		return version
+	}
+
+	major, _, _ := strings.Cut(version, ".")
+	return fmt.Sprintf("~> %s", major)
+}
@@ -10,6 +10,7 @@ import (
 
 	bundleinstall "github.com/paketo-buildpacks/bundle-install"
 	"github.com/paketo-buildpacks/bundle-install/fakes"
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 	"github.com/sclevine/spec"
@@ -22,8 +23,9 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 		Expect = NewWithT(t).Expect
 
 		workingDir            string
-		gemfileParser         *fakes.VersionParser
+		gemfileParser         *fakes.GemfileVersionParser
 		rubyVersionFileParser *fakes.VersionParser
+		lockfileParser        *fakes.LockfileParser
 		detect                packit.DetectFunc
 		buffer                *bytes.Buffer
 	)
@@ -36,11 +38,14 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 		err = os.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte{}, 0644)
 		Expect(err).NotTo(HaveOccurred())
 
-		gemfileParser = &fakes.VersionParser{}
+		gemfileParser = &fakes.GemfileVersionParser{}
 		rubyVersionFileParser = &fakes.VersionParser{}
+		lockfileParser = &fakes.LockfileParser{}
 		buffer = bytes.NewBuffer(nil)
 
-		detect = bundleinstall.Detect(gemfileParser, rubyVersionFileParser, scribe.NewEmitter(buffer))
+		detect = bundleinstall.Detect(gemfileParser, rubyVersionFileParser, lockfileParser, scribe.NewEmitter(buffer), bundleinstall.Environment{
+			BundlerVersionPolicy: bundleinstall.BundlerVersionPolicyMajor,
+		})
 	})
 
 	it.After(func() {
@@ -71,6 +76,94 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 				},
 			},
 		}))
+
+		Expect(lockfileParser.ParseCall.Receives.Path).To(Equal(filepath.Join(workingDir, "Gemfile.lock")))
+	})
+
+	context("when the Gemfile.lock lists a BUNDLED WITH version", func() {
+		it.Before(func() {
+			lockfileParser.ParseCall.Returns.Lockfile = lockfile.Lockfile{BundledWith: "2.5.3"}
+		})
+
+		it("requires a bundler version with the same major version", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan.Requires).To(ContainElement(packit.BuildPlanRequirement{
+				Name: "bundler",
+				Metadata: bundleinstall.BuildPlanMetadata{
+					Version:       "~> 2",
+					VersionSource: "Gemfile.lock",
+					Build:         true,
+				},
+			}))
+		})
+
+		context("when the bundler version policy is exact", func() {
+			it.Before(func() {
+				detect = bundleinstall.Detect(gemfileParser, rubyVersionFileParser, lockfileParser, scribe.NewEmitter(buffer), bundleinstall.Environment{
+					BundlerVersionPolicy: bundleinstall.BundlerVersionPolicyExact,
+				})
+			})
+
+			it("requires that exact version of bundler", func() {
+				result, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan.Requires).To(ContainElement(packit.BuildPlanRequirement{
+					Name: "bundler",
+					Metadata: bundleinstall.BuildPlanMetadata{
+						Version:       "2.5.3",
+						VersionSource: "Gemfile.lock",
+						Build:         true,
+					},
+				}))
+			})
+		})
+
+		context("when the bundler version policy is none", func() {
+			it.Before(func() {
+				detect = bundleinstall.Detect(gemfileParser, rubyVersionFileParser, lockfileParser, scribe.NewEmitter(buffer), bundleinstall.Environment{
+					BundlerVersionPolicy: bundleinstall.BundlerVersionPolicyNone,
+				})
+			})
+
+			it("does not require a specific version of bundler", func() {
+				result, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan.Requires).To(ContainElement(packit.BuildPlanRequirement{
+					Name: "bundler",
+					Metadata: bundleinstall.BuildPlanMetadata{
+						Build: true,
+					},
+				}))
+
+			})
+		})
+	})
+
+	context("when the Gemfile.lock does not exist", func() {
+		it.Before(func() {
+			_, err := os.Stat("/no/Gemfile.lock")
+			lockfileParser.ParseCall.Returns.Error = fmt.Errorf("failed to parse Gemfile.lock: %w", err)
+		})
+
+		it("does not require a specific version of bundler", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan.Requires).To(ContainElement(packit.BuildPlanRequirement{
+				Name: "bundler",
+				Metadata: bundleinstall.BuildPlanMetadata{
+					Build: true,
+				},
+			}))
+		})
 	})
 
 	context("when the Gemfile specifies an mri ruby version", func() {
@@ -107,8 +200,167 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when the Gemfile specifies an alternative ruby engine", func() {
+		it.Before(func() {
+			gemfileParser.ParseVersionCall.Returns.Version = "3.1.4"
+			gemfileParser.ParseEngineCall.Returns.Engine = "jruby"
+			gemfileParser.ParseEngineCall.Returns.EngineVersion = "9.4.5.0"
+		})
+
+		it("requires that engine at the engine version instead of mri", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan.Requires).To(Equal([]packit.BuildPlanRequirement{
+				{
+					Name: "bundler",
+					Metadata: bundleinstall.BuildPlanMetadata{
+						Build: true,
+					},
+				},
+				{
+					Name: "jruby",
+					Metadata: bundleinstall.BuildPlanMetadata{
+						Version:       "9.4.5.0",
+						VersionSource: "Gemfile",
+						Build:         true,
+					},
+				},
+			}))
+
+			Expect(gemfileParser.ParseEngineCall.Receives.Path).To(Equal(filepath.Join(workingDir, "Gemfile")))
+		})
+
+		context("when the engine is truffleruby without an engine version", func() {
+			it.Before(func() {
+				gemfileParser.ParseEngineCall.Returns.Engine = "truffleruby"
+				gemfileParser.ParseEngineCall.Returns.EngineVersion = ""
+			})
+
+			it("requires any version of that engine", func() {
+				result, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan.Requires[1]).To(Equal(packit.BuildPlanRequirement{
+					Name: "truffleruby",
+					Metadata: bundleinstall.BuildPlanMetadata{
+						Build: true,
+					},
+				}))
+			})
+		})
+
+		context("when the engine is explicitly ruby", func() {
+			it.Before(func() {
+				gemfileParser.ParseEngineCall.Returns.Engine = "ruby"
+				gemfileParser.ParseEngineCall.Returns.EngineVersion = "3.1.4"
+			})
+
+			it("requires that version of mri", func() {
+				result, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan.Requires[1]).To(Equal(packit.BuildPlanRequirement{
+					Name: "mri",
+					Metadata: bundleinstall.BuildPlanMetadata{
+						Version:       "3.1.4",
+						VersionSource: "Gemfile",
+						Build:         true,
+					},
+				}))
+			})
+		})
+
+		context("when no buildpack provides the engine", func() {
+			it.Before(func() {
+				gemfileParser.ParseEngineCall.Returns.Engine = "rbx"
+			})
+
+			it("fails detection", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).To(MatchError(packit.Fail.WithMessage(`Gemfile requires the "rbx" Ruby engine, which is not provided by any buildpack: use one of "ruby", "jruby" or "truffleruby"`)))
+			})
+		})
+	})
+
+	context("when the app uses gems.rb and gems.locked", func() {
+		it.Before(func() {
+			Expect(os.Remove(filepath.Join(workingDir, "Gemfile"))).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "gems.rb"), nil, 0644)).To(Succeed())
+
+			gemfileParser.ParseVersionCall.Returns.Version = "~> 3.2"
+			lockfileParser.ParseCall.Returns.Lockfile = lockfile.Lockfile{BundledWith: "2.5.3"}
+		})
+
+		it("parses those files instead", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan.Requires).To(Equal([]packit.BuildPlanRequirement{
+				{
+					Name: "bundler",
+					Metadata: bundleinstall.BuildPlanMetadata{
+						Version:       "~> 2",
+						VersionSource: "gems.locked",
+						Build:         true,
+					},
+				},
+				{
+					Name: "mri",
+					Metadata: bundleinstall.BuildPlanMetadata{
+						Version:       "~> 3.2",
+						VersionSource: "gems.rb",
+						Build:         true,
+					},
+				},
+			}))
+
+			Expect(gemfileParser.ParseVersionCall.Receives.Path).To(Equal(filepath.Join(workingDir, "gems.rb")))
+			Expect(lockfileParser.ParseCall.Receives.Path).To(Equal(filepath.Join(workingDir, "gems.locked")))
+		})
+	})
+
+	context("when the Gemfile location is configured", func() {
+		it.Before(func() {
+			detect = bundleinstall.Detect(gemfileParser, rubyVersionFileParser, lockfileParser, scribe.NewEmitter(buffer), bundleinstall.Environment{
+				Gemfile: "Gemfile.next",
+			})
+		})
+
+		it("parses that Gemfile and its lockfile", func() {
+			_, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(gemfileParser.ParseVersionCall.Receives.Path).To(Equal(filepath.Join(workingDir, "Gemfile.next")))
+			Expect(lockfileParser.ParseCall.Receives.Path).To(Equal(filepath.Join(workingDir, "Gemfile.next.lock")))
+		})
+	})
+
+	context("when both a Gemfile and a gems.rb exist", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "gems.rb"), nil, 0644)).To(Succeed())
+		})
+
+		it("returns an error", func() {
+			_, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).To(MatchError("found both Gemfile and gems.rb files: remove either Gemfile and Gemfile.lock or gems.rb and gems.locked"))
+		})
+	})
+
 	context("when a Gemfile does not exist", func() {
 		it.Before(func() {
+			Expect(os.Remove(filepath.Join(workingDir, "Gemfile"))).To(Succeed())
+
 			_, err := os.Stat("/no/gemfile")
 			gemfileParser.ParseVersionCall.Returns.Err = fmt.Errorf("failed to parse Gemfile: %w", err)
 		})
@@ -121,6 +373,21 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when a file the Gemfile refers to does not exist", func() {
+		it.Before(func() {
+			_, err := os.Stat("/no/ruby-version")
+			gemfileParser.ParseVersionCall.Returns.Err = fmt.Errorf("failed to parse Ruby version from Gemfile ruby file: directive: %w", err)
+		})
+
+		it("returns an error", func() {
+			_, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).To(MatchError(ContainSubstring("failed to parse Ruby version from Gemfile ruby file: directive")))
+			Expect(err).NotTo(MatchError(packit.Fail))
+		})
+	})
+
 	context("when the buildpack.yml parser fails", func() {
 		it.Before(func() {
 			gemfileParser.ParseVersionCall.Returns.Err = errors.New("some-error")
@@ -134,6 +401,32 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when the Gemfile engine parser fails", func() {
+		it.Before(func() {
+			gemfileParser.ParseEngineCall.Returns.Err = errors.New("some-error")
+		})
+
+		it("returns an error", func() {
+			_, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).To(MatchError("some-error"))
+		})
+	})
+
+	context("when the Gemfile.lock parser fails", func() {
+		it.Before(func() {
+			lockfileParser.ParseCall.Returns.Error = errors.New("some-error")
+		})
+
+		it("returns an error", func() {
+			_, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).To(MatchError("some-error"))
+		})
+	})
+
 	context("when the Gemfile has no version it falls back to .ruby-version", func() {
 		it.Before(func() {
 			gemfileParser.ParseVersionCall.Returns.Version = ""
@@ -166,6 +459,173 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 					},
 				},
 			}))
+
+			Expect(rubyVersionFileParser.ParseVersionCall.CallCount).To(Equal(4))
+		})
+	})
+
+	context("when the Gemfile and .ruby-version have no version it falls back to the Gemfile.lock", func() {
+		it.Before(func() {
+			gemfileParser.ParseVersionCall.Returns.Version = ""
+			rubyVersionFileParser.ParseVersionCall.Returns.Err = fmt.Errorf("failed to read .ruby-version file: %w", os.ErrNotExist)
+			lockfileParser.ParseCall.Returns.Lockfile = lockfile.Lockfile{
+				RubyVersion: lockfile.RubyVersion{
+					Version:    "3.2.2",
+					Patchlevel: "53",
+				},
+			}
+		})
+
+		it("requires that version of mri without the patchlevel", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan.Requires).To(ContainElement(packit.BuildPlanRequirement{
+				Name: "mri",
+				Metadata: bundleinstall.BuildPlanMetadata{
+					Version:       "3.2.2",
+					VersionSource: "Gemfile.lock",
+					Build:         true,
+				},
+			}))
+			Expect(buffer.String()).NotTo(ContainSubstring("Could not parse the .ruby-version file"))
+		})
+
+		context("when the .ruby-version also has a version", func() {
+			it.Before(func() {
+				rubyVersionFileParser.ParseVersionCall.Returns.Version = "3.3.0"
+				rubyVersionFileParser.ParseVersionCall.Returns.Err = nil
+			})
+
+			it("prefers the .ruby-version", func() {
+				result, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan.Requires).To(ContainElement(packit.BuildPlanRequirement{
+					Name: "mri",
+					Metadata: bundleinstall.BuildPlanMetadata{
+						Version:       "3.3.0",
+						VersionSource: ".ruby-version",
+						Build:         true,
+					},
+				}))
+			})
+		})
+
+		context("when the Gemfile.lock ruby is not mri", func() {
+			it.Before(func() {
+				lockfileParser.ParseCall.Returns.Lockfile.RubyVersion.Engine = "jruby"
+				lockfileParser.ParseCall.Returns.Lockfile.RubyVersion.EngineVersion = "9.4.5.0"
+			})
+
+			it("does not require that version of mri", func() {
+				result, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan.Requires).To(ContainElement(packit.BuildPlanRequirement{
+					Name: "mri",
+					Metadata: bundleinstall.BuildPlanMetadata{
+						Build: true,
+					},
+				}))
+			})
+		})
+	})
+
+	context("when the Gemfile has no version and only a .tool-versions file specifies one", func() {
+		it.Before(func() {
+			gemfileParser.ParseVersionCall.Returns.Version = ""
+			rubyVersionFileParser.ParseVersionCall.Stub = func(path string) (string, error) {
+				if filepath.Base(path) == ".tool-versions" {
+					return "3.1.4", nil
+				}
+
+				return "", fmt.Errorf("failed to read file: %w", os.ErrNotExist)
+			}
+		})
+
+		it("requires that version of mri", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan.Requires).To(ContainElement(packit.BuildPlanRequirement{
+				Name: "mri",
+				Metadata: bundleinstall.BuildPlanMetadata{
+					Version:       "3.1.4",
+					VersionSource: ".tool-versions",
+					Build:         true,
+				},
+			}))
+
+			Expect(rubyVersionFileParser.ParseVersionCall.CallCount).To(Equal(4))
+			Expect(buffer.String()).NotTo(ContainSubstring("WARNING"))
+		})
+	})
+
+	context("when the Ruby version sources conflict", func() {
+		it.Before(func() {
+			gemfileParser.ParseVersionCall.Returns.Version = "~> 3.2.0"
+			rubyVersionFileParser.ParseVersionCall.Stub = func(path string) (string, error) {
+				if filepath.Base(path) == ".ruby-version" {
+					return "3.3.0", nil
+				}
+
+				return "", fmt.Errorf("failed to read file: %w", os.ErrNotExist)
+			}
+			lockfileParser.ParseCall.Returns.Lockfile = lockfile.Lockfile{
+				RubyVersion: lockfile.RubyVersion{Version: "3.2.2"},
+			}
+		})
+
+		it("requires the version with the highest precedence and warns about the conflict", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan.Requires).To(ContainElement(packit.BuildPlanRequirement{
+				Name: "mri",
+				Metadata: bundleinstall.BuildPlanMetadata{
+					Version:       "~> 3.2.0",
+					VersionSource: "Gemfile",
+					Build:         true,
+				},
+			}))
+
+			Expect(buffer.String()).To(ContainSubstring(`WARNING: the Ruby version "3.3.0" in .ruby-version conflicts with "~> 3.2.0" in Gemfile, using the version from Gemfile`))
+			Expect(buffer.String()).NotTo(ContainSubstring("Gemfile.lock"))
+		})
+
+		context("when strict mode is enabled", func() {
+			it.Before(func() {
+				detect = bundleinstall.Detect(gemfileParser, rubyVersionFileParser, lockfileParser, scribe.NewEmitter(buffer), bundleinstall.Environment{
+					RubyVersionStrict: true,
+				})
+			})
+
+			it("fails detection", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).To(MatchError(packit.Fail.WithMessage(`the Ruby version "3.3.0" in .ruby-version conflicts with "~> 3.2.0" in Gemfile: make the Ruby versions agree or unset $BP_RUBY_VERSION_STRICT`)))
+			})
+		})
+
+		context("when the Gemfile constraint only gives the minor version", func() {
+			it.Before(func() {
+				gemfileParser.ParseVersionCall.Returns.Version = "~> 3.2"
+			})
+
+			it("warns that the mri buildpack will not install that version", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buffer.String()).To(ContainSubstring(`WARNING: the Ruby version "3.3.0" in .ruby-version conflicts with "~> 3.2" in Gemfile, using the version from Gemfile`))
+			})
 		})
 	})
 
@@ -6,21 +6,155 @@ import (
 	"strings"
 )
 
+const (
+	// BundlerVersionPolicyExact requires the exact version of Bundler listed in
+	// the BUNDLED WITH section of the Gemfile.lock.
+	BundlerVersionPolicyExact = "exact"
+
+	// BundlerVersionPolicyMajor requires any version of Bundler with the same
+	// major version as the one listed in the BUNDLED WITH section of the
+	// Gemfile.lock.
+	BundlerVersionPolicyMajor = "major"
+
+	// BundlerVersionPolicyNone does not require any specific version of
+	// Bundler.
+	BundlerVersionPolicyNone = "none"
+)
+
 type Environment struct {
 	KeepGemExtensionBuildFiles bool
+	BundlerVersionPolicy       string
+	Gemfile                    string
+	RubyVersionStrict          bool
+	ForceRubyPlatform          bool
+	Frozen                     bool
+	RequireLockfile            bool
+	ForceInstall               bool
+	RebuildOnRubyPatch         bool
+	LaunchGroups               GemGroups
+	BuildGroups                GemGroups
+
+	// BundleEnvironment is the set of BUNDLE_* environment variables, other
+	// than BUNDLE_USER_CONFIG which the buildpack sets itself.
+	BundleEnvironment []string
+
+	// BundleGemfile is the value of the BUNDLE_GEMFILE environment variable,
+	// which Bundler uses to locate the Gemfile unless the application's
+	// .bundle/config sets it.
+	BundleGemfile string
 }
 
 func ParseEnvironment(environ []string) (Environment, error) {
-	var environment Environment
+	environment := Environment{
+		BundlerVersionPolicy: BundlerVersionPolicyMajor,
+		LaunchGroups: GemGroups{
+			Without: []string{"development", "test"},
+		},
+	}
+
 	for _, variable := range environ {
-		if value, found := strings.CutPrefix(variable, "BP_KEEP_GEM_EXTENSION_BUILD_FILES="); found {
+		name, value, _ := strings.Cut(variable, "=")
+
+		switch name {
+		case "BP_KEEP_GEM_EXTENSION_BUILD_FILES":
 			var err error
 			environment.KeepGemExtensionBuildFiles, err = strconv.ParseBool(value)
 			if err != nil {
 				return Environment{}, fmt.Errorf("failed to parse BP_KEEP_GEM_EXTENSION_BUILD_FILES: %w", err)
 			}
+
+		case "BP_RUBY_VERSION_STRICT":
+			var err error
+			environment.RubyVersionStrict, err = strconv.ParseBool(value)
+			if err != nil {
+				return Environment{}, fmt.Errorf("failed to parse BP_RUBY_VERSION_STRICT: %w", err)
+			}
+
+		case "BP_BUNDLE_FORCE_RUBY_PLATFORM":
+			var err error
+			environment.ForceRubyPlatform, err = strconv.ParseBool(value)
+			if err != nil {
+				return Environment{}, fmt.Errorf("failed to parse BP_BUNDLE_FORCE_RUBY_PLATFORM: %w", err)
+			}
+
+		case "BP_BUNDLE_FROZEN":
+			var err error
+			environment.Frozen, err = strconv.ParseBool(value)
+			if err != nil {
+				return Environment{}, fmt.Errorf("failed to parse BP_BUNDLE_FROZEN: %w", err)
+			}
+
+		case "BP_BUNDLE_REQUIRE_LOCKFILE":
+			var err error
+			environment.RequireLockfile, err = strconv.ParseBool(value)
+			if err != nil {
+				return Environment{}, fmt.Errorf("failed to parse BP_BUNDLE_REQUIRE_LOCKFILE: %w", err)
+			}
+
+		case "BP_BUNDLE_FORCE_INSTALL", "BP_BUNDLE_CLEAN_CACHE":
+			force, err := strconv.ParseBool(value)
+			if err != nil {
+				return Environment{}, fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+			environment.ForceInstall = environment.ForceInstall || force
+
+		case "BP_BUNDLE_REBUILD_ON_RUBY_PATCH":
+			var err error
+			environment.RebuildOnRubyPatch, err = strconv.ParseBool(value)
+			if err != nil {
+				return Environment{}, fmt.Errorf("failed to parse BP_BUNDLE_REBUILD_ON_RUBY_PATCH: %w", err)
+			}
+
+		case "BP_BUNDLE_GEMFILE":
+			environment.Gemfile = value
+
+		case "BP_BUNDLE_WITHOUT":
+			environment.LaunchGroups.Without = parseGemGroups(value)
+
+		case "BP_BUNDLE_WITH":
+			environment.LaunchGroups.With = parseGemGroups(value)
+
+		case "BP_BUNDLE_ONLY":
+			environment.LaunchGroups.Only = parseGemGroups(value)
+
+		case "BP_BUNDLE_BUILD_WITHOUT":
+			environment.BuildGroups.Without = parseGemGroups(value)
+
+		case "BP_BUNDLE_BUILD_WITH":
+			environment.BuildGroups.With = parseGemGroups(value)
+
+		case "BP_BUNDLE_BUILD_ONLY":
+			environment.BuildGroups.Only = parseGemGroups(value)
+
+		case "BP_BUNDLER_VERSION_POLICY":
+			switch value {
+			case BundlerVersionPolicyExact, BundlerVersionPolicyMajor, BundlerVersionPolicyNone:
+				environment.BundlerVersionPolicy = value
+			default:
+				return Environment{}, fmt.Errorf("failed to parse BP_BUNDLER_VERSION_POLICY: %q is not one of %q, %q or %q", value, BundlerVersionPolicyExact, BundlerVersionPolicyMajor, BundlerVersionPolicyNone)
+			}
+
+		case "BUNDLE_USER_CONFIG":
+			// the buildpack points Bundler at the configuration in each layer
+
+		case "BUNDLE_GEMFILE":
+			environment.BundleGemfile = value
+			environment.BundleEnvironment = append(environment.BundleEnvironment, variable)
+
+		default:
+			if strings.HasPrefix(name, "BUNDLE_") {
+				environment.BundleEnvironment = append(environment.BundleEnvironment, variable)
+			}
 		}
 	}
 
 	return environment, nil
 }
+
+// parseGemGroups splits a list of groups separated by colons or spaces, as
+// accepted by Bundler, or by commas.
+func parseGemGroups(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ':' || r == ' ' || r == ','
+	})
+}
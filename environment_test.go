@@ -18,6 +18,10 @@ func testEnvironment(t *testing.T, context spec.G, it spec.S) {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(environment).To(Equal(bundleinstall.Environment{
 				KeepGemExtensionBuildFiles: false,
+				BundlerVersionPolicy:       "major",
+				LaunchGroups: bundleinstall.GemGroups{
+					Without: []string{"development", "test"},
+				},
 			}))
 		})
 
@@ -29,10 +33,166 @@ func testEnvironment(t *testing.T, context spec.G, it spec.S) {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(environment).To(Equal(bundleinstall.Environment{
 					KeepGemExtensionBuildFiles: true,
+					BundlerVersionPolicy:       "major",
+					LaunchGroups: bundleinstall.GemGroups{
+						Without: []string{"development", "test"},
+					},
 				}))
 			})
 		})
 
+		context("when BP_BUNDLE_GEMFILE is set", func() {
+			it("parse the environment variables", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BP_BUNDLE_GEMFILE=Gemfile.next",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.Gemfile).To(Equal("Gemfile.next"))
+			})
+		})
+
+		context("when BP_RUBY_VERSION_STRICT is set", func() {
+			it("parse the environment variables", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BP_RUBY_VERSION_STRICT=true",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.RubyVersionStrict).To(BeTrue())
+			})
+		})
+
+		context("when BP_BUNDLE_FORCE_RUBY_PLATFORM is set", func() {
+			it("parse the environment variables", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BP_BUNDLE_FORCE_RUBY_PLATFORM=true",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.ForceRubyPlatform).To(BeTrue())
+			})
+		})
+
+		context("when the gem group variables are set", func() {
+			it("parse the environment variables", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BP_BUNDLE_WITHOUT=development:test:ci",
+					"BP_BUNDLE_WITH=production_only",
+					"BP_BUNDLE_ONLY=",
+					"BP_BUNDLE_BUILD_WITHOUT=tools",
+					"BP_BUNDLE_BUILD_WITH=assets ci",
+					"BP_BUNDLE_BUILD_ONLY=default,assets",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.LaunchGroups).To(Equal(bundleinstall.GemGroups{
+					Without: []string{"development", "test", "ci"},
+					With:    []string{"production_only"},
+					Only:    []string{},
+				}))
+				Expect(environment.BuildGroups).To(Equal(bundleinstall.GemGroups{
+					Without: []string{"tools"},
+					With:    []string{"assets", "ci"},
+					Only:    []string{"default", "assets"},
+				}))
+			})
+
+			it("selects the groups in the Bundler configuration", func() {
+				Expect(bundleinstall.GemGroups{
+					Without: []string{"development", "test"},
+					Only:    []string{"default", "assets"},
+				}.Config()).To(Equal(map[string]string{
+					"without": "development:test",
+					"only":    "default:assets",
+				}))
+			})
+		})
+
+		context("when BP_BUNDLE_FROZEN is set", func() {
+			it("parse the environment variables", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BP_BUNDLE_FROZEN=true",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.Frozen).To(BeTrue())
+			})
+		})
+
+		context("when BP_BUNDLE_REQUIRE_LOCKFILE is set", func() {
+			it("parse the environment variables", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BP_BUNDLE_REQUIRE_LOCKFILE=true",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.RequireLockfile).To(BeTrue())
+			})
+		})
+
+		context("when BP_BUNDLE_FORCE_INSTALL is set", func() {
+			it("parse the environment variables", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BP_BUNDLE_FORCE_INSTALL=true",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.ForceInstall).To(BeTrue())
+			})
+		})
+
+		context("when BP_BUNDLE_CLEAN_CACHE is set", func() {
+			it("parse the environment variables", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BP_BUNDLE_CLEAN_CACHE=true",
+					"BP_BUNDLE_FORCE_INSTALL=false",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.ForceInstall).To(BeTrue())
+			})
+		})
+
+		context("when BP_BUNDLE_REBUILD_ON_RUBY_PATCH is set", func() {
+			it("parse the environment variables", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BP_BUNDLE_REBUILD_ON_RUBY_PATCH=true",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.RebuildOnRubyPatch).To(BeTrue())
+			})
+		})
+
+		context("when BUNDLE_* variables are set", func() {
+			it("collects them, other than BUNDLE_USER_CONFIG", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BUNDLE_JOBS=4",
+					"BUNDLE_USER_CONFIG=/some/config",
+					"BUNDLE_BUILD__NOKOGIRI=--use-system-libraries",
+					"PATH=/usr/bin",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.BundleEnvironment).To(Equal([]string{
+					"BUNDLE_JOBS=4",
+					"BUNDLE_BUILD__NOKOGIRI=--use-system-libraries",
+				}))
+			})
+		})
+
+		context("when BUNDLE_GEMFILE is set", func() {
+			it("collects it and keeps it for locating the Gemfile", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BUNDLE_GEMFILE=sub/Gemfile",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.BundleGemfile).To(Equal("sub/Gemfile"))
+				Expect(environment.BundleEnvironment).To(Equal([]string{"BUNDLE_GEMFILE=sub/Gemfile"}))
+			})
+		})
+
+		context("when BP_BUNDLER_VERSION_POLICY is set", func() {
+			it("parse the environment variables", func() {
+				environment, err := bundleinstall.ParseEnvironment([]string{
+					"BP_BUNDLER_VERSION_POLICY=exact",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(environment.BundlerVersionPolicy).To(Equal("exact"))
+			})
+		})
+
 		context("failure cases", func() {
 			context("when the BP_KEEP_GEM_EXTENSION_BUILD_FILES env var cannot be parsed", func() {
 				it("returns an error", func() {
@@ -43,6 +203,85 @@ func testEnvironment(t *testing.T, context spec.G, it spec.S) {
 					Expect(err).To(MatchError(ContainSubstring(`parsing "banana": invalid syntax`)))
 				})
 			})
+
+			context("when the BP_RUBY_VERSION_STRICT env var cannot be parsed", func() {
+				it("returns an error", func() {
+					_, err := bundleinstall.ParseEnvironment([]string{
+						"BP_RUBY_VERSION_STRICT=banana",
+					})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_RUBY_VERSION_STRICT:")))
+					Expect(err).To(MatchError(ContainSubstring(`parsing "banana": invalid syntax`)))
+				})
+			})
+
+			context("when the BP_BUNDLE_FORCE_RUBY_PLATFORM env var cannot be parsed", func() {
+				it("returns an error", func() {
+					_, err := bundleinstall.ParseEnvironment([]string{
+						"BP_BUNDLE_FORCE_RUBY_PLATFORM=banana",
+					})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_BUNDLE_FORCE_RUBY_PLATFORM:")))
+					Expect(err).To(MatchError(ContainSubstring(`parsing "banana": invalid syntax`)))
+				})
+			})
+
+			context("when the BP_BUNDLE_FROZEN env var cannot be parsed", func() {
+				it("returns an error", func() {
+					_, err := bundleinstall.ParseEnvironment([]string{
+						"BP_BUNDLE_FROZEN=banana",
+					})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_BUNDLE_FROZEN:")))
+					Expect(err).To(MatchError(ContainSubstring(`parsing "banana": invalid syntax`)))
+				})
+			})
+
+			context("when the BP_BUNDLE_REQUIRE_LOCKFILE env var cannot be parsed", func() {
+				it("returns an error", func() {
+					_, err := bundleinstall.ParseEnvironment([]string{
+						"BP_BUNDLE_REQUIRE_LOCKFILE=banana",
+					})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_BUNDLE_REQUIRE_LOCKFILE:")))
+					Expect(err).To(MatchError(ContainSubstring(`parsing "banana": invalid syntax`)))
+				})
+			})
+
+			context("when the BP_BUNDLE_FORCE_INSTALL env var cannot be parsed", func() {
+				it("returns an error", func() {
+					_, err := bundleinstall.ParseEnvironment([]string{
+						"BP_BUNDLE_FORCE_INSTALL=banana",
+					})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_BUNDLE_FORCE_INSTALL:")))
+					Expect(err).To(MatchError(ContainSubstring(`parsing "banana": invalid syntax`)))
+				})
+			})
+
+			context("when the BP_BUNDLE_REBUILD_ON_RUBY_PATCH env var cannot be parsed", func() {
+				it("returns an error", func() {
+					_, err := bundleinstall.ParseEnvironment([]string{
+						"BP_BUNDLE_REBUILD_ON_RUBY_PATCH=banana",
+					})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_BUNDLE_REBUILD_ON_RUBY_PATCH:")))
+					Expect(err).To(MatchError(ContainSubstring(`parsing "banana": invalid syntax`)))
+				})
+			})
+
+			context("when the BP_BUNDLE_CLEAN_CACHE env var cannot be parsed", func() {
+				it("returns an error", func() {
+					_, err := bundleinstall.ParseEnvironment([]string{
+						"BP_BUNDLE_CLEAN_CACHE=banana",
+					})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_BUNDLE_CLEAN_CACHE:")))
+					Expect(err).To(MatchError(ContainSubstring(`parsing "banana": invalid syntax`)))
+				})
+			})
+
+			context("when the BP_BUNDLER_VERSION_POLICY env var is not a known policy", func() {
+				it("returns an error", func() {
+					_, err := bundleinstall.ParseEnvironment([]string{
+						"BP_BUNDLER_VERSION_POLICY=banana",
+					})
+					Expect(err).To(MatchError(`failed to parse BP_BUNDLER_VERSION_POLICY: "banana" is not one of "exact", "major" or "none"`))
+				})
+			})
 		})
 	})
 }
@@ -0,0 +1,55 @@
+package fakes
+
+import (
+	"sync"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+)
+
+type GemfileDependencyParser struct {
+	ParseDependenciesCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			Path string
+		}
+		Returns struct {
+			GemfileDependencies bundleinstall.GemfileDependencies
+			Error               error
+		}
+		Stub func(string) (bundleinstall.GemfileDependencies, error)
+	}
+	ParseGroupsCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			Path string
+		}
+		Returns struct {
+			GemfileGroups bundleinstall.GemfileGroups
+			Error         error
+		}
+		Stub func(string) (bundleinstall.GemfileGroups, error)
+	}
+}
+
+func (f *GemfileDependencyParser) ParseDependencies(param1 string) (bundleinstall.GemfileDependencies, error) {
+	f.ParseDependenciesCall.mutex.Lock()
+	defer f.ParseDependenciesCall.mutex.Unlock()
+	f.ParseDependenciesCall.CallCount++
+	f.ParseDependenciesCall.Receives.Path = param1
+	if f.ParseDependenciesCall.Stub != nil {
+		return f.ParseDependenciesCall.Stub(param1)
+	}
+	return f.ParseDependenciesCall.Returns.GemfileDependencies, f.ParseDependenciesCall.Returns.Error
+}
+func (f *GemfileDependencyParser) ParseGroups(param1 string) (bundleinstall.GemfileGroups, error) {
+	f.ParseGroupsCall.mutex.Lock()
+	defer f.ParseGroupsCall.mutex.Unlock()
+	f.ParseGroupsCall.CallCount++
+	f.ParseGroupsCall.Receives.Path = param1
+	if f.ParseGroupsCall.Stub != nil {
+		return f.ParseGroupsCall.Stub(param1)
+	}
+	return f.ParseGroupsCall.Returns.GemfileGroups, f.ParseGroupsCall.Returns.Error
+}
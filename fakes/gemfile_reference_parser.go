@@ -0,0 +1,33 @@
+package fakes
+
+import (
+	"sync"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+)
+
+type GemfileReferenceParser struct {
+	ParseReferencesCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			Path string
+		}
+		Returns struct {
+			GemfileReferences bundleinstall.GemfileReferences
+			Error             error
+		}
+		Stub func(string) (bundleinstall.GemfileReferences, error)
+	}
+}
+
+func (f *GemfileReferenceParser) ParseReferences(param1 string) (bundleinstall.GemfileReferences, error) {
+	f.ParseReferencesCall.mutex.Lock()
+	defer f.ParseReferencesCall.mutex.Unlock()
+	f.ParseReferencesCall.CallCount++
+	f.ParseReferencesCall.Receives.Path = param1
+	if f.ParseReferencesCall.Stub != nil {
+		return f.ParseReferencesCall.Stub(param1)
+	}
+	return f.ParseReferencesCall.Returns.GemfileReferences, f.ParseReferencesCall.Returns.Error
+}
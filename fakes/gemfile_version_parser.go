@@ -0,0 +1,52 @@
+package fakes
+
+import "sync"
+
+type GemfileVersionParser struct {
+	ParseEngineCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			Path string
+		}
+		Returns struct {
+			Engine        string
+			EngineVersion string
+			Err           error
+		}
+		Stub func(string) (string, string, error)
+	}
+	ParseVersionCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			Path string
+		}
+		Returns struct {
+			Version string
+			Err     error
+		}
+		Stub func(string) (string, error)
+	}
+}
+
+func (f *GemfileVersionParser) ParseEngine(param1 string) (string, string, error) {
+	f.ParseEngineCall.mutex.Lock()
+	defer f.ParseEngineCall.mutex.Unlock()
+	f.ParseEngineCall.CallCount++
+	f.ParseEngineCall.Receives.Path = param1
+	if f.ParseEngineCall.Stub != nil {
+		return f.ParseEngineCall.Stub(param1)
+	}
+	return f.ParseEngineCall.Returns.Engine, f.ParseEngineCall.Returns.EngineVersion, f.ParseEngineCall.Returns.Err
+}
+func (f *GemfileVersionParser) ParseVersion(param1 string) (string, error) {
+	f.ParseVersionCall.mutex.Lock()
+	defer f.ParseVersionCall.mutex.Unlock()
+	f.ParseVersionCall.CallCount++
+	f.ParseVersionCall.Receives.Path = param1
+	if f.ParseVersionCall.Stub != nil {
+		return f.ParseVersionCall.Stub(param1)
+	}
+	return f.ParseVersionCall.Returns.Version, f.ParseVersionCall.Returns.Err
+}
@@ -0,0 +1,34 @@
+package fakes
+
+import (
+	"sync"
+
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+)
+
+type GitCache struct {
+	VerifyCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			Path string
+			Lock lockfile.Lockfile
+		}
+		Returns struct {
+			Error error
+		}
+		Stub func(string, lockfile.Lockfile) error
+	}
+}
+
+func (f *GitCache) Verify(param1 string, param2 lockfile.Lockfile) error {
+	f.VerifyCall.mutex.Lock()
+	defer f.VerifyCall.mutex.Unlock()
+	f.VerifyCall.CallCount++
+	f.VerifyCall.Receives.Path = param1
+	f.VerifyCall.Receives.Lock = param2
+	if f.VerifyCall.Stub != nil {
+		return f.VerifyCall.Stub(param1, param2)
+	}
+	return f.VerifyCall.Returns.Error
+}
@@ -1,21 +1,39 @@
 package fakes
 
-import "sync"
+import (
+	"sync"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+)
 
 type InstallProcess struct {
+	ConfigureCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			WorkingDir string
+			LayerPath  string
+			Config     map[string]string
+		}
+		Returns struct {
+			Error error
+		}
+		Stub func(string, string, map[string]string) error
+	}
 	ExecuteCall struct {
 		mutex     sync.Mutex
 		CallCount int
 		Receives  struct {
-			WorkingDir     string
-			LayerPath      string
-			Config         map[string]string
-			KeepBuildFiles bool
+			WorkingDir        string
+			LayerPath         string
+			DownloadCachePath string
+			Config            map[string]string
+			KeepBuildFiles    bool
 		}
 		Returns struct {
 			Error error
 		}
-		Stub func(string, string, map[string]string, bool) error
+		Stub func(string, string, string, map[string]string, bool) error
 	}
 	ShouldRunCall struct {
 		mutex     sync.Mutex
@@ -24,40 +42,57 @@ type InstallProcess struct {
 			Metadata map[string]interface {
 			}
 			WorkingDir string
+			Manifest   bundleinstall.Manifest
+			Settings   bundleinstall.InstallSettings
 		}
 		Returns struct {
-			Should      bool
-			Checksum    string
-			RubyVersion string
-			Err         error
+			Reasons []string
+			Key     bundleinstall.CacheKey
+			RubyABI bundleinstall.RubyABI
+			Err     error
 		}
 		Stub func(map[string]interface {
-		}, string) (bool, string, string, error)
+		}, string, bundleinstall.Manifest, bundleinstall.InstallSettings) ([]string, bundleinstall.CacheKey, bundleinstall.RubyABI, error)
 	}
 }
 
-func (f *InstallProcess) Execute(param1 string, param2 string, param3 map[string]string, param4 bool) error {
+func (f *InstallProcess) Configure(param1 string, param2 string, param3 map[string]string) error {
+	f.ConfigureCall.mutex.Lock()
+	defer f.ConfigureCall.mutex.Unlock()
+	f.ConfigureCall.CallCount++
+	f.ConfigureCall.Receives.WorkingDir = param1
+	f.ConfigureCall.Receives.LayerPath = param2
+	f.ConfigureCall.Receives.Config = param3
+	if f.ConfigureCall.Stub != nil {
+		return f.ConfigureCall.Stub(param1, param2, param3)
+	}
+	return f.ConfigureCall.Returns.Error
+}
+func (f *InstallProcess) Execute(param1 string, param2 string, param3 string, param4 map[string]string, param5 bool) error {
 	f.ExecuteCall.mutex.Lock()
 	defer f.ExecuteCall.mutex.Unlock()
 	f.ExecuteCall.CallCount++
 	f.ExecuteCall.Receives.WorkingDir = param1
 	f.ExecuteCall.Receives.LayerPath = param2
-	f.ExecuteCall.Receives.Config = param3
-	f.ExecuteCall.Receives.KeepBuildFiles = param4
+	f.ExecuteCall.Receives.DownloadCachePath = param3
+	f.ExecuteCall.Receives.Config = param4
+	f.ExecuteCall.Receives.KeepBuildFiles = param5
 	if f.ExecuteCall.Stub != nil {
-		return f.ExecuteCall.Stub(param1, param2, param3, param4)
+		return f.ExecuteCall.Stub(param1, param2, param3, param4, param5)
 	}
 	return f.ExecuteCall.Returns.Error
 }
 func (f *InstallProcess) ShouldRun(param1 map[string]interface {
-}, param2 string) (bool, string, string, error) {
+}, param2 string, param3 bundleinstall.Manifest, param4 bundleinstall.InstallSettings) ([]string, bundleinstall.CacheKey, bundleinstall.RubyABI, error) {
 	f.ShouldRunCall.mutex.Lock()
 	defer f.ShouldRunCall.mutex.Unlock()
 	f.ShouldRunCall.CallCount++
 	f.ShouldRunCall.Receives.Metadata = param1
 	f.ShouldRunCall.Receives.WorkingDir = param2
+	f.ShouldRunCall.Receives.Manifest = param3
+	f.ShouldRunCall.Receives.Settings = param4
 	if f.ShouldRunCall.Stub != nil {
-		return f.ShouldRunCall.Stub(param1, param2)
+		return f.ShouldRunCall.Stub(param1, param2, param3, param4)
 	}
-	return f.ShouldRunCall.Returns.Should, f.ShouldRunCall.Returns.Checksum, f.ShouldRunCall.Returns.RubyVersion, f.ShouldRunCall.Returns.Err
+	return f.ShouldRunCall.Returns.Reasons, f.ShouldRunCall.Returns.Key, f.ShouldRunCall.Returns.RubyABI, f.ShouldRunCall.Returns.Err
 }
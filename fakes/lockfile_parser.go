@@ -0,0 +1,33 @@
+package fakes
+
+import (
+	"sync"
+
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+)
+
+type LockfileParser struct {
+	ParseCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			Path string
+		}
+		Returns struct {
+			Lockfile lockfile.Lockfile
+			Error    error
+		}
+		Stub func(string) (lockfile.Lockfile, error)
+	}
+}
+
+func (f *LockfileParser) Parse(param1 string) (lockfile.Lockfile, error) {
+	f.ParseCall.mutex.Lock()
+	defer f.ParseCall.mutex.Unlock()
+	f.ParseCall.CallCount++
+	f.ParseCall.Receives.Path = param1
+	if f.ParseCall.Stub != nil {
+		return f.ParseCall.Stub(param1)
+	}
+	return f.ParseCall.Returns.Lockfile, f.ParseCall.Returns.Error
+}
@@ -0,0 +1,65 @@
+package bundleinstall
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+)
+
+// PruneGemCache removes the .gem files that are not locked by the given
+// lockfile from the Bundler download cache at the given path, so that the
+// cache does not grow without bound as gems are updated. It returns the names
+// of the removed files.
+//
+// With the global gem cache enabled, Bundler keeps the .gem files of each
+// source in a "gems/<source>" directory of its user cache. A file is kept when
+// it matches the name and version of a locked gem, whatever its platform, as
+// Bundler may download the generic "ruby" platform variant of a locked gem.
+// The compact index is left in place, as its size is bounded by the sources.
+func PruneGemCache(path string, lock lockfile.Lockfile) ([]string, error) {
+	locked := map[string]bool{}
+	for _, spec := range lock.Specs() {
+		locked[fmt.Sprintf("%s-%s", spec.Name, spec.Version)] = true
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "gems", "*", "*.gem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, file := range files {
+		if lockedGemFile(locked, strings.TrimSuffix(filepath.Base(file), ".gem")) {
+			continue
+		}
+
+		err = os.Remove(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prune gem cache: %w", err)
+		}
+
+		removed = append(removed, filepath.Base(file))
+	}
+
+	return removed, nil
+}
+
+// lockedGemFile returns true if the given .gem file name, without its
+// extension, is a locked "<name>-<version>", optionally followed by a
+// "-<platform>".
+func lockedGemFile(locked map[string]bool, name string) bool {
+	if locked[name] {
+		return true
+	}
+
+	for i := strings.LastIndex(name, "-"); i > 0; i = strings.LastIndex(name[:i], "-") {
+		if locked[name[:i]] {
+			return true
+		}
+	}
+
+	return false
+}
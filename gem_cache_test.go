@@ -0,0 +1,105 @@
+package bundleinstall_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGemCache(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path string
+		lock lockfile.Lockfile
+	)
+
+	it.Before(func() {
+		path = t.TempDir()
+
+		lock = lockfile.Lockfile{
+			Sources: []lockfile.Source{
+				{
+					Type: lockfile.SourceTypeGem,
+					Specs: []lockfile.Spec{
+						{Name: "rack", Version: "3.0.8"},
+						{Name: "nokogiri", Version: "1.16.0", Platform: "x86_64-linux"},
+						{Name: "net-http", Version: "0.4.1"},
+					},
+				},
+			},
+		}
+
+		for _, dir := range []string{"rubygems.org.443.some-digest", "gems.example.com.443.other-digest"} {
+			Expect(os.MkdirAll(filepath.Join(path, "gems", dir), os.ModePerm)).To(Succeed())
+		}
+
+		for _, file := range []string{
+			"rubygems.org.443.some-digest/rack-3.0.8.gem",
+			"rubygems.org.443.some-digest/rack-2.2.8.gem",
+			"rubygems.org.443.some-digest/nokogiri-1.16.0-x86_64-linux.gem",
+			"rubygems.org.443.some-digest/nokogiri-1.16.0.gem",
+			"rubygems.org.443.some-digest/nokogiri-1.15.0-x86_64-linux.gem",
+			"rubygems.org.443.some-digest/net-http-0.4.1.gem",
+			"rubygems.org.443.some-digest/net-0.4.1.gem",
+			"gems.example.com.443.other-digest/private-1.0.0.gem",
+		} {
+			Expect(os.WriteFile(filepath.Join(path, "gems", file), nil, 0600)).To(Succeed())
+		}
+
+		Expect(os.MkdirAll(filepath.Join(path, "compact_index", "rubygems.org.443.some-digest"), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, "compact_index", "rubygems.org.443.some-digest", "versions"), nil, 0600)).To(Succeed())
+	})
+
+	context("PruneGemCache", func() {
+		it("removes the gems that are not locked", func() {
+			removed, err := bundleinstall.PruneGemCache(path, lock)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(removed).To(ConsistOf(
+				"private-1.0.0.gem",
+				"rack-2.2.8.gem",
+				"nokogiri-1.15.0-x86_64-linux.gem",
+				"net-0.4.1.gem",
+			))
+
+			Expect(filepath.Join(path, "gems", "rubygems.org.443.some-digest", "rack-3.0.8.gem")).To(BeAnExistingFile())
+			Expect(filepath.Join(path, "gems", "rubygems.org.443.some-digest", "nokogiri-1.16.0-x86_64-linux.gem")).To(BeAnExistingFile())
+			Expect(filepath.Join(path, "gems", "rubygems.org.443.some-digest", "nokogiri-1.16.0.gem")).To(BeAnExistingFile())
+			Expect(filepath.Join(path, "gems", "rubygems.org.443.some-digest", "net-http-0.4.1.gem")).To(BeAnExistingFile())
+			Expect(filepath.Join(path, "gems", "rubygems.org.443.some-digest", "rack-2.2.8.gem")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(path, "compact_index", "rubygems.org.443.some-digest", "versions")).To(BeAnExistingFile())
+		})
+
+		context("when the cache is empty", func() {
+			it("removes nothing", func() {
+				removed, err := bundleinstall.PruneGemCache(t.TempDir(), lock)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(removed).To(BeEmpty())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when a gem cannot be removed", func() {
+				it.Before(func() {
+					Expect(os.Chmod(filepath.Join(path, "gems", "gems.example.com.443.other-digest"), 0500)).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Chmod(filepath.Join(path, "gems", "gems.example.com.443.other-digest"), os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := bundleinstall.PruneGemCache(path, lock)
+					Expect(err).To(MatchError(ContainSubstring("failed to prune gem cache")))
+					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,108 @@
+package bundleinstall
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2"
+)
+
+// groupConfigKeys are the Bundler configuration keys that select the groups.
+var groupConfigKeys = []string{"without", "with", "only"}
+
+// GemGroups selects the Bundler groups that are installed into a layer. Only
+// takes precedence over With and Without, following Bundler.
+type GemGroups struct {
+	Without []string
+	With    []string
+	Only    []string
+}
+
+// Config returns the Bundler configuration that selects the groups.
+func (g GemGroups) Config() map[string]string {
+	config := map[string]string{}
+	for key, groups := range map[string][]string{"without": g.Without, "with": g.With, "only": g.Only} {
+		if len(groups) > 0 {
+			config[key] = strings.Join(groups, ":")
+		}
+	}
+
+	return config
+}
+
+// String returns a representation of the groups that is suitable for
+// detecting a change in the group selection.
+func (g GemGroups) String() string {
+	return fmt.Sprintf("without=%s;with=%s;only=%s", strings.Join(g.Without, ":"), strings.Join(g.With, ":"), strings.Join(g.Only, ":"))
+}
+
+// MergeGemGroups adds the groups requested through the metadata of the "gems"
+// build plan entries that require gems in the given phase, "build" or
+// "launch", to the given groups. A requirer asks for groups using a "groups"
+// list and excludes them using a "without-groups" list:
+//
+//	[[requires]]
+//	  name = "gems"
+//	  [requires.metadata]
+//	    build = true
+//	    groups = ["assets"]
+//	    without-groups = ["test"]
+//
+// The union of the requested groups is installed, even where another
+// requirer, or the buildpack configuration, excludes them.
+func MergeGemGroups(groups GemGroups, phase string, entries []packit.BuildpackPlanEntry) GemGroups {
+	var requested, excluded []string
+	for _, entry := range entries {
+		if entry.Name != GemsDependency {
+			continue
+		}
+
+		if required, ok := entry.Metadata[phase].(bool); !ok || !required {
+			continue
+		}
+
+		requested = appendGroups(requested, entry.Metadata["groups"])
+		excluded = appendGroups(excluded, entry.Metadata["without-groups"])
+	}
+
+	merged := GemGroups{
+		With: appendGroups(append([]string(nil), groups.With...), requested),
+	}
+
+	for _, group := range appendGroups(append([]string(nil), groups.Without...), excluded) {
+		if !slices.Contains(requested, group) {
+			merged.Without = append(merged.Without, group)
+		}
+	}
+
+	if len(groups.Only) > 0 {
+		merged.Only = appendGroups(append([]string(nil), groups.Only...), requested)
+	}
+
+	return merged
+}
+
+// appendGroups appends the groups in the given build plan metadata value, or
+// group slice, that are not already present.
+func appendGroups(groups []string, value interface{}) []string {
+	var values []string
+	switch value := value.(type) {
+	case []string:
+		values = value
+	case []interface{}:
+		for _, v := range value {
+			values = append(values, fmt.Sprint(v))
+		}
+	case string:
+		values = parseGemGroups(value)
+	}
+
+	for _, group := range values {
+		if !slices.Contains(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,85 @@
+package bundleinstall_test
+
+import (
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGemGroups(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("MergeGemGroups", func() {
+		var entries []packit.BuildpackPlanEntry
+
+		it.Before(func() {
+			entries = []packit.BuildpackPlanEntry{
+				{
+					Name: "gems",
+					Metadata: map[string]interface{}{
+						"build":          true,
+						"groups":         []interface{}{"assets"},
+						"without-groups": []interface{}{"tools"},
+					},
+				},
+				{
+					Name: "gems",
+					Metadata: map[string]interface{}{
+						"build":  true,
+						"launch": true,
+						"groups": []interface{}{"test", "assets"},
+					},
+				},
+				{
+					Name: "gems",
+					Metadata: map[string]interface{}{
+						"launch":         true,
+						"without-groups": []interface{}{"test"},
+					},
+				},
+				{
+					Name: "other",
+					Metadata: map[string]interface{}{
+						"build":  true,
+						"groups": []interface{}{"other"},
+					},
+				},
+			}
+		})
+
+		it("merges the groups requested for the phase", func() {
+			Expect(bundleinstall.MergeGemGroups(bundleinstall.GemGroups{}, "build", entries)).To(Equal(bundleinstall.GemGroups{
+				Without: []string{"tools"},
+				With:    []string{"assets", "test"},
+			}))
+		})
+
+		it("installs requested groups that are excluded by another requirer or the configuration", func() {
+			Expect(bundleinstall.MergeGemGroups(bundleinstall.GemGroups{
+				Without: []string{"development", "test"},
+			}, "launch", entries)).To(Equal(bundleinstall.GemGroups{
+				Without: []string{"development"},
+				With:    []string{"test", "assets"},
+			}))
+		})
+
+		it("adds requested groups to the only selection", func() {
+			Expect(bundleinstall.MergeGemGroups(bundleinstall.GemGroups{
+				Only: []string{"default"},
+			}, "build", entries)).To(Equal(bundleinstall.GemGroups{
+				Without: []string{"tools"},
+				With:    []string{"assets", "test"},
+				Only:    []string{"default", "assets", "test"},
+			}))
+		})
+
+		it("returns the given groups when no groups are requested", func() {
+			groups := bundleinstall.GemGroups{Without: []string{"development", "test"}}
+			Expect(bundleinstall.MergeGemGroups(groups, "launch", nil)).To(Equal(groups))
+		})
+	})
+}
@@ -0,0 +1,201 @@
+package bundleinstall
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+)
+
+var (
+	groupBlockExpression  = regexp.MustCompile(`^\s*group(?:\s+|\s*\()(.*?)\)?\s*do(?:\s*\|[^|]*\|)?\s*$`)
+	groupOptionExpression = regexp.MustCompile(`(?:\b(?:group|groups):\s*|:(?:group|groups)\s*=>\s*)(\[[^\]]*\]|:\w+|"[^"]*"|'[^']*')`)
+	optionalExpression    = regexp.MustCompile(`(?:\boptional:\s*|:optional\s*=>\s*)true\b`)
+	groupNameExpression   = regexp.MustCompile(`:(\w+)|"([^"]*)"|'([^']*)'`)
+)
+
+// GemfileGroups is the set of Bundler groups that each gem declared in a
+// Gemfile belongs to.
+type GemfileGroups struct {
+	// Groups is the set of groups of each gem, by name. Gems declared outside
+	// of any group belong to the "default" group.
+	Groups map[string][]string
+
+	// Optional is the set of optional groups, which are only installed when
+	// they are selected through "with".
+	Optional []string
+
+	// Indirect is true when the Gemfile declares further dependencies through
+	// "gemspec" or "eval_gemfile", whose groups are not known.
+	Indirect bool
+}
+
+// ParseGroups scans the Gemfile for the groups of the gems it declares,
+// through "group" blocks and "group" or "groups" options.
+//
+// As with ParseDependencies, the Gemfile is not evaluated, so only groups
+// given as literal symbols or strings are understood.
+func (p GemfileParser) ParseGroups(path string) (GemfileGroups, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return GemfileGroups{}, fmt.Errorf("failed to parse Gemfile: %w", err)
+	}
+	defer file.Close()
+
+	groups := GemfileGroups{Groups: map[string][]string{}}
+
+	var blocks [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := stripRubyComment(scanner.Text())
+
+		switch {
+		case blockEndExpression.MatchString(line):
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+			continue
+
+		case conditionStartExpression.MatchString(line):
+			blocks = append(blocks, nil)
+			continue
+
+		case indirectExpression.MatchString(line):
+			groups.Indirect = true
+			continue
+		}
+
+		if matches := gemDirectiveExpression.FindStringSubmatch(line); matches != nil {
+			var gemGroups []string
+			for _, block := range blocks {
+				gemGroups = appendGroups(gemGroups, block)
+			}
+
+			if option := groupOptionExpression.FindStringSubmatch(matches[3]); option != nil {
+				gemGroups = appendGroups(gemGroups, parseGroupNames(option[1]))
+			}
+
+			if len(gemGroups) == 0 {
+				gemGroups = []string{"default"}
+			}
+
+			name := matches[1] + matches[2]
+			groups.Groups[name] = appendGroups(groups.Groups[name], gemGroups)
+			continue
+		}
+
+		if matches := groupBlockExpression.FindStringSubmatch(line); matches != nil {
+			arguments := optionalExpression.Split(matches[1], -1)
+			names := parseGroupNames(arguments[0])
+			if len(arguments) > 1 {
+				groups.Optional = appendGroups(groups.Optional, names)
+			}
+
+			blocks = append(blocks, names)
+			continue
+		}
+
+		if blockStartExpression.MatchString(line) {
+			blocks = append(blocks, nil)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return GemfileGroups{}, fmt.Errorf("failed to parse Gemfile: %w", err)
+	}
+
+	return groups, nil
+}
+
+// parseGroupNames returns the group names given as symbols or strings.
+func parseGroupNames(value string) []string {
+	var names []string
+	for _, name := range groupNameExpression.FindAllStringSubmatch(value, -1) {
+		names = append(names, name[1]+name[2]+name[3])
+	}
+
+	return names
+}
+
+// SelectGems returns the names of the locked gems that Bundler installs for
+// the given group selection, in order. A dependency of the lockfile is
+// selected when any of its groups is selected, following Bundler, and the
+// gems it depends on are selected along with it.
+//
+// The selection is not known when the Gemfile declares dependencies
+// indirectly, or when the lockfile has no dependencies, in which case false
+// is returned.
+func SelectGems(lock lockfile.Lockfile, gemfile GemfileGroups, selection GemGroups) ([]string, bool) {
+	if gemfile.Indirect || len(lock.Dependencies) == 0 {
+		return nil, false
+	}
+
+	dependencies := map[string][]string{}
+	for _, spec := range lock.Specs() {
+		for _, dependency := range spec.Dependencies {
+			dependencies[spec.Name] = append(dependencies[spec.Name], dependency.Name)
+		}
+	}
+
+	selected := map[string]bool{"bundler": true}
+	var visit func(name string)
+	visit = func(name string) {
+		if selected[name] {
+			return
+		}
+
+		selected[name] = true
+		for _, dependency := range dependencies[name] {
+			visit(dependency)
+		}
+	}
+
+	for _, dependency := range lock.Dependencies {
+		groups, ok := gemfile.Groups[dependency.Name]
+		if !ok {
+			groups = []string{"default"}
+		}
+
+		if selection.selects(groups, gemfile.Optional) {
+			visit(dependency.Name)
+		}
+	}
+
+	var names []string
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, true
+}
+
+// selects returns true if any of the given groups is installed by the group
+// selection.
+func (g GemGroups) selects(groups, optional []string) bool {
+	for _, group := range groups {
+		if len(g.Only) > 0 {
+			if slices.Contains(g.Only, group) {
+				return true
+			}
+			continue
+		}
+
+		if slices.Contains(g.Without, group) {
+			continue
+		}
+
+		if slices.Contains(optional, group) && !slices.Contains(g.With, group) {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
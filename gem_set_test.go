@@ -0,0 +1,186 @@
+package bundleinstall_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGemSet(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path   string
+		parser bundleinstall.GemfileParser
+	)
+
+	it.Before(func() {
+		file, err := os.CreateTemp("", "Gemfile")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+
+		path = file.Name()
+
+		parser = bundleinstall.NewGemfileParser()
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(path)).To(Succeed())
+	})
+
+	context("ParseGroups", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(path, []byte(`source "https://rubygems.org"
+
+gem "rails"
+gem "pg", group: :production
+gem "debug", groups: [:development, :test]
+gem "yard", :group => "docs"
+
+group :development, :test do
+  gem "rspec-rails"
+
+  if ENV["WITH_BOOTSNAP"]
+    gem "bootsnap"
+  end
+end
+
+group(:tools, optional: true) do
+  gem "rubocop"
+end
+
+git "https://github.com/rails/sprockets.git" do
+  gem "sprockets"
+end
+`), 0644)).To(Succeed())
+		})
+
+		it("returns the groups of each declared gem", func() {
+			groups, err := parser.ParseGroups(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(groups).To(Equal(bundleinstall.GemfileGroups{
+				Groups: map[string][]string{
+					"rails":       {"default"},
+					"pg":          {"production"},
+					"debug":       {"development", "test"},
+					"yard":        {"docs"},
+					"rspec-rails": {"development", "test"},
+					"bootsnap":    {"development", "test"},
+					"rubocop":     {"tools"},
+					"sprockets":   {"default"},
+				},
+				Optional: []string{"tools"},
+			}))
+		})
+
+		context("when the Gemfile declares dependencies indirectly", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(path, []byte("source 'https://rubygems.org'\n\ngemspec\n"), 0644)).To(Succeed())
+			})
+
+			it("reports that the dependencies are indirect", func() {
+				groups, err := parser.ParseGroups(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(groups.Indirect).To(BeTrue())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the Gemfile does not exist", func() {
+				it.Before(func() {
+					Expect(os.Remove(path)).To(Succeed())
+				})
+
+				it("returns an ErrNotExist error", func() {
+					_, err := parser.ParseGroups(path)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse Gemfile:")))
+					Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+				})
+			})
+		})
+	})
+
+	context("SelectGems", func() {
+		var (
+			lock   lockfile.Lockfile
+			groups bundleinstall.GemfileGroups
+		)
+
+		it.Before(func() {
+			lock = lockfile.Lockfile{
+				Sources: []lockfile.Source{
+					{
+						Type: lockfile.SourceTypeGem,
+						Specs: []lockfile.Spec{
+							{Name: "rails", Version: "7.1.2", Dependencies: []lockfile.Dependency{{Name: "rack"}}},
+							{Name: "rack", Version: "3.0.8"},
+							{Name: "rspec-rails", Version: "6.1.0", Dependencies: []lockfile.Dependency{{Name: "rspec-core"}, {Name: "rack"}}},
+							{Name: "rspec-core", Version: "3.13.0"},
+							{Name: "rubocop", Version: "1.60.0"},
+						},
+					},
+				},
+				Dependencies: []lockfile.Dependency{
+					{Name: "rails"},
+					{Name: "rspec-rails"},
+					{Name: "rubocop"},
+				},
+			}
+
+			groups = bundleinstall.GemfileGroups{
+				Groups: map[string][]string{
+					"rails":       {"default"},
+					"rspec-rails": {"development", "test"},
+					"rubocop":     {"tools"},
+				},
+				Optional: []string{"tools"},
+			}
+		})
+
+		it("returns the gems installed for the selected groups and their dependencies", func() {
+			names, ok := bundleinstall.SelectGems(lock, groups, bundleinstall.GemGroups{Without: []string{"development", "test"}})
+			Expect(ok).To(BeTrue())
+			Expect(names).To(Equal([]string{"bundler", "rack", "rails"}))
+
+			names, ok = bundleinstall.SelectGems(lock, groups, bundleinstall.GemGroups{})
+			Expect(ok).To(BeTrue())
+			Expect(names).To(Equal([]string{"bundler", "rack", "rails", "rspec-core", "rspec-rails"}))
+		})
+
+		it("selects optional groups through with", func() {
+			names, ok := bundleinstall.SelectGems(lock, groups, bundleinstall.GemGroups{With: []string{"tools"}, Without: []string{"test"}})
+			Expect(ok).To(BeTrue())
+			Expect(names).To(Equal([]string{"bundler", "rack", "rails", "rspec-core", "rspec-rails", "rubocop"}))
+		})
+
+		it("selects only the given groups through only", func() {
+			names, ok := bundleinstall.SelectGems(lock, groups, bundleinstall.GemGroups{Only: []string{"test"}})
+			Expect(ok).To(BeTrue())
+			Expect(names).To(Equal([]string{"bundler", "rack", "rspec-core", "rspec-rails"}))
+		})
+
+		context("when the Gemfile declares dependencies indirectly", func() {
+			it.Before(func() {
+				groups.Indirect = true
+			})
+
+			it("reports that the selection is not known", func() {
+				_, ok := bundleinstall.SelectGems(lock, groups, bundleinstall.GemGroups{})
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		context("when the lockfile has no dependencies", func() {
+			it("reports that the selection is not known", func() {
+				_, ok := bundleinstall.SelectGems(lockfile.Lockfile{}, groups, bundleinstall.GemGroups{})
+				Expect(ok).To(BeFalse())
+			})
+		})
+	})
+}
@@ -0,0 +1,243 @@
+package bundleinstall
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// gemEntryDirectories are the directories of a gem install root that hold an
+// entry, a directory or a file named after the full name of the gem, for each
+// installed gem.
+var gemEntryDirectories = []string{"gems", "specifications", "cache", "build_info", "doc"}
+
+// immutableDirectories are the directories of a gem install root whose
+// contents are not changed once a gem is installed, and so can be shared
+// between layers through hardlinks.
+var immutableDirectories = append([]string{"extensions", "bundler"}, gemEntryDirectories...)
+
+// GemTransfer is the outcome of transferring the gems of one layer into
+// another.
+type GemTransfer struct {
+	// Reflinked, Hardlinked and Copied are the number of files transferred
+	// through each method.
+	Reflinked  int
+	Hardlinked int
+	Copied     int
+
+	// Skipped is the set of full names, such as "rspec-3.13.0", of the gems
+	// that were not transferred.
+	Skipped []string
+}
+
+// TransferGems transfers the contents of the layer at the source path into
+// the layer at the destination path, other than the gems that are not among
+// the given gem names. When the gem names are nil, every gem is transferred.
+//
+// Each file is cloned through a reflink, where the filesystem supports it, so
+// that the layers share storage until either is changed. Otherwise, the files
+// of installed gems, which are not changed once installed, are hardlinked,
+// and the remaining files, such as binstubs and configuration, are copied.
+func TransferGems(source, destination string, names []string) (GemTransfer, error) {
+	var keep map[string]bool
+	if names != nil {
+		keep = map[string]bool{}
+		for _, name := range names {
+			keep[name] = true
+		}
+	}
+
+	t := transfer{canReflink: true, canHardlink: true}
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+
+		if fullName, ok := gemEntry(relative); ok && keep != nil && !keptGem(keep, fullName) {
+			t.result.Skipped = appendUnique(t.result.Skipped, fullName)
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		target := filepath.Join(destination, relative)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			err = removeExisting(target)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+
+		case entry.Type().IsRegular():
+			return t.file(path, target, info.Mode().Perm(), immutable(relative))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return GemTransfer{}, fmt.Errorf("failed to transfer gems: %w", err)
+	}
+
+	return t.result, nil
+}
+
+// transfer tracks which methods of transferring a file the filesystem
+// supports, so that an unsupported method is attempted only once.
+type transfer struct {
+	canReflink  bool
+	canHardlink bool
+	result      GemTransfer
+}
+
+func (t *transfer) file(source, destination string, mode fs.FileMode, immutable bool) error {
+	err := removeExisting(destination)
+	if err != nil {
+		return err
+	}
+
+	if t.canReflink {
+		err = reflink(source, destination, mode)
+		if err == nil {
+			t.result.Reflinked++
+			return nil
+		}
+		t.canReflink = false
+	}
+
+	if immutable && t.canHardlink {
+		err = os.Link(source, destination)
+		if err == nil {
+			t.result.Hardlinked++
+			return nil
+		}
+		t.canHardlink = false
+	}
+
+	err = copyFile(source, destination, mode)
+	if err != nil {
+		return err
+	}
+	t.result.Copied++
+
+	return nil
+}
+
+// gemEntry returns the full name of the gem that the given path, relative to
+// a layer, is the entry of, such as "rack-3.0.8" for
+// "ruby/3.2.0/gems/rack-3.0.8" or
+// "ruby/3.2.0/extensions/x86_64-linux/3.2.0/nokogiri-1.16.0-x86_64-linux".
+// Git gems, installed in the "bundler" directory, are not named after their
+// gem and so are not entries.
+func gemEntry(path string) (string, bool) {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(parts) < 4 || !slices.Contains(rubyEngines, parts[0]) {
+		return "", false
+	}
+
+	var name string
+	switch {
+	case slices.Contains(gemEntryDirectories, parts[2]) && len(parts) == 4:
+		name = parts[3]
+	case parts[2] == "extensions" && len(parts) == 6:
+		name = parts[5]
+	default:
+		return "", false
+	}
+
+	for _, extension := range []string{".gemspec", ".gem", ".info"} {
+		name = strings.TrimSuffix(name, extension)
+	}
+
+	return name, len(gemNames(name)) > 0
+}
+
+// gemNames returns the names that the gem with the given full name can have,
+// such that "nokogiri-1.16.0-x86_64-linux" can be named "nokogiri". As names
+// can contain dashes, the version is any segment that starts with a digit.
+func gemNames(fullName string) []string {
+	var names []string
+	segments := strings.Split(fullName, "-")
+	for i := 1; i < len(segments); i++ {
+		if segments[i] != "" && segments[i][0] >= '0' && segments[i][0] <= '9' {
+			names = append(names, strings.Join(segments[:i], "-"))
+		}
+	}
+
+	return names
+}
+
+// keptGem returns true if the gem with the given full name is among the
+// given gem names.
+func keptGem(keep map[string]bool, fullName string) bool {
+	for _, name := range gemNames(fullName) {
+		if keep[name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// immutable returns true if the given path, relative to a layer, is in a
+// directory whose contents are not changed once installed.
+func immutable(path string) bool {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	return len(parts) > 3 && slices.Contains(rubyEngines, parts[0]) && slices.Contains(immutableDirectories, parts[2])
+}
+
+func removeExisting(path string) error {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func copyFile(source, destination string, mode fs.FileMode) error {
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.OpenFile(destination, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	_, err = io.Copy(output, input)
+	if err != nil {
+		return err
+	}
+
+	return output.Close()
+}
@@ -0,0 +1,158 @@
+package bundleinstall_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGemTransfer(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		source      string
+		destination string
+	)
+
+	it.Before(func() {
+		source = t.TempDir()
+		destination = t.TempDir()
+
+		root := filepath.Join(source, "ruby", "3.2.0")
+		for _, dir := range []string{
+			"gems/rack-3.0.8/lib",
+			"gems/rspec-core-3.13.0",
+			"specifications",
+			"cache",
+			"extensions/x86_64-linux/3.2.0/nokogiri-1.16.0-x86_64-linux",
+			"bin",
+		} {
+			Expect(os.MkdirAll(filepath.Join(root, dir), os.ModePerm)).To(Succeed())
+		}
+
+		for file, contents := range map[string]string{
+			"gems/rack-3.0.8/lib/rack.rb":                                            "rack",
+			"gems/rspec-core-3.13.0/rspec":                                           "rspec",
+			"specifications/rack-3.0.8.gemspec":                                      "rack-spec",
+			"specifications/rspec-core-3.13.0.gemspec":                               "rspec-spec",
+			"cache/rspec-core-3.13.0.gem":                                            "rspec-gem",
+			"extensions/x86_64-linux/3.2.0/nokogiri-1.16.0-x86_64-linux/nokogiri.so": "nokogiri",
+			"bin/rackup": "rackup",
+		} {
+			Expect(os.WriteFile(filepath.Join(root, file), []byte(contents), 0644)).To(Succeed())
+		}
+
+		Expect(os.WriteFile(filepath.Join(source, "config"), []byte("some-config"), 0600)).To(Succeed())
+		Expect(os.Symlink("rack-3.0.8", filepath.Join(root, "gems", "rack"))).To(Succeed())
+	})
+
+	context("TransferGems", func() {
+		it("transfers every gem", func() {
+			transfer, err := bundleinstall.TransferGems(source, destination, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(transfer.Reflinked + transfer.Hardlinked + transfer.Copied).To(Equal(8))
+			Expect(transfer.Skipped).To(BeEmpty())
+
+			root := filepath.Join(destination, "ruby", "3.2.0")
+			content, err := os.ReadFile(filepath.Join(root, "gems", "rack-3.0.8", "lib", "rack.rb"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("rack"))
+
+			Expect(filepath.Join(root, "gems", "rspec-core-3.13.0", "rspec")).To(BeARegularFile())
+			Expect(filepath.Join(root, "extensions", "x86_64-linux", "3.2.0", "nokogiri-1.16.0-x86_64-linux", "nokogiri.so")).To(BeARegularFile())
+
+			link, err := os.Readlink(filepath.Join(root, "gems", "rack"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link).To(Equal("rack-3.0.8"))
+
+			content, err = os.ReadFile(filepath.Join(destination, "config"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("some-config"))
+
+			info, err := os.Stat(filepath.Join(destination, "config"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		it("shares the files of installed gems and copies the rest", func() {
+			transfer, err := bundleinstall.TransferGems(source, destination, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			if transfer.Reflinked > 0 {
+				t.Skip("filesystem supports reflinks")
+			}
+
+			Expect(transfer.Hardlinked).To(Equal(6))
+			Expect(transfer.Copied).To(Equal(2))
+
+			sourceInfo, err := os.Stat(filepath.Join(source, "ruby", "3.2.0", "gems", "rack-3.0.8", "lib", "rack.rb"))
+			Expect(err).NotTo(HaveOccurred())
+			destinationInfo, err := os.Stat(filepath.Join(destination, "ruby", "3.2.0", "gems", "rack-3.0.8", "lib", "rack.rb"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.SameFile(sourceInfo, destinationInfo)).To(BeTrue())
+
+			sourceInfo, err = os.Stat(filepath.Join(source, "ruby", "3.2.0", "bin", "rackup"))
+			Expect(err).NotTo(HaveOccurred())
+			destinationInfo, err = os.Stat(filepath.Join(destination, "ruby", "3.2.0", "bin", "rackup"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.SameFile(sourceInfo, destinationInfo)).To(BeFalse())
+		})
+
+		context("when given the names of the gems to transfer", func() {
+			it("skips the other gems", func() {
+				transfer, err := bundleinstall.TransferGems(source, destination, []string{"bundler", "rack", "nokogiri"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(transfer.Skipped).To(Equal([]string{"rspec-core-3.13.0"}))
+
+				root := filepath.Join(destination, "ruby", "3.2.0")
+				Expect(filepath.Join(root, "gems", "rack-3.0.8", "lib", "rack.rb")).To(BeARegularFile())
+				Expect(filepath.Join(root, "specifications", "rack-3.0.8.gemspec")).To(BeARegularFile())
+				Expect(filepath.Join(root, "extensions", "x86_64-linux", "3.2.0", "nokogiri-1.16.0-x86_64-linux")).To(BeADirectory())
+				Expect(filepath.Join(root, "bin", "rackup")).To(BeARegularFile())
+
+				Expect(filepath.Join(root, "gems", "rspec-core-3.13.0")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(root, "specifications", "rspec-core-3.13.0.gemspec")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(root, "cache", "rspec-core-3.13.0.gem")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		context("when the destination already holds the files", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(destination, "ruby", "3.2.0", "bin"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(destination, "ruby", "3.2.0", "bin", "rackup"), []byte("old-rackup"), 0644)).To(Succeed())
+			})
+
+			it("replaces them", func() {
+				_, err := bundleinstall.TransferGems(source, destination, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				content, err := os.ReadFile(filepath.Join(destination, "ruby", "3.2.0", "bin", "rackup"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).To(Equal("rackup"))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the source cannot be read", func() {
+				it.Before(func() {
+					Expect(os.Chmod(filepath.Join(source, "ruby"), 0000)).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Chmod(filepath.Join(source, "ruby"), os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := bundleinstall.TransferGems(source, destination, nil)
+					Expect(err).To(MatchError(ContainSubstring("failed to transfer gems")))
+					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,268 @@
+package bundleinstall
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+)
+
+var (
+	gemDirectiveExpression   = regexp.MustCompile(`^\s*gem(?:\s+|\s*\()\s*(?:"([^"]+)"|'([^']+)')(.*)$`)
+	blockStartExpression     = regexp.MustCompile(`^\s*(\w+)\b.*\bdo(?:\s*\|[^|]*\|)?\s*$`)
+	conditionStartExpression = regexp.MustCompile(`^\s*(?:if|unless|case|while|until|begin|def)\b`)
+	blockEndExpression       = regexp.MustCompile(`^\s*end\b`)
+	modifierExpression       = regexp.MustCompile(`\s(?:if|unless)\s`)
+	indirectExpression       = regexp.MustCompile(`^\s*(?:gemspec|eval_gemfile)\b`)
+	gemRequirementExpression = regexp.MustCompile(`^(~>|<=|>=|!=|<|>|=)?\s*[0-9][0-9A-Za-z.]*$`)
+)
+
+// gemSourceOptions are the gem options, and block directives, that install a
+// gem from a source other than the default gem server. Bundler marks such
+// dependencies as pinned ("!") in the lockfile.
+var gemSourceOptions = []string{"git", "github", "gitlab", "bitbucket", "path", "source"}
+
+// conditionalBlocks are the block directives whose gems are only declared
+// under some conditions.
+var conditionalBlocks = []string{"install_if", "env"}
+
+// GemfileDependencies is the set of dependencies declared by the "gem"
+// directives of a Gemfile.
+type GemfileDependencies struct {
+	Dependencies []lockfile.Dependency
+
+	// Conditional is the set of gem names that are declared inside of a
+	// conditional, such as an "if" statement, and so may be absent from the
+	// lockfile.
+	Conditional []string
+
+	// Indirect is true when the Gemfile declares further dependencies through
+	// "gemspec" or "eval_gemfile", which are not included.
+	Indirect bool
+}
+
+// ParseDependencies scans the Gemfile for the gems it declares, along with
+// their version requirements.
+//
+// The Gemfile is not evaluated, so only "gem" directives given literal
+// strings are understood, although their arguments may span several lines.
+// Gems declared inside of conditionals are reported separately, as whether
+// they are declared depends on the environment in which the lockfile was
+// generated.
+func (p GemfileParser) ParseDependencies(path string) (GemfileDependencies, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return GemfileDependencies{}, fmt.Errorf("failed to parse Gemfile: %w", err)
+	}
+	defer file.Close()
+
+	type block struct {
+		pinned      bool
+		conditional bool
+	}
+
+	var (
+		dependencies GemfileDependencies
+		blocks       []block
+	)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := stripRubyComment(scanner.Text())
+
+		// a directive whose arguments span several lines ends each of its
+		// lines, other than the last, with a comma
+		for strings.HasSuffix(strings.TrimSpace(line), ",") && scanner.Scan() {
+			line = strings.TrimSpace(line) + " " + strings.TrimSpace(stripRubyComment(scanner.Text()))
+		}
+
+		var pinned, conditional bool
+		for _, b := range blocks {
+			pinned = pinned || b.pinned
+			conditional = conditional || b.conditional
+		}
+
+		switch {
+		case blockEndExpression.MatchString(line):
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+			continue
+
+		case conditionStartExpression.MatchString(line):
+			blocks = append(blocks, block{conditional: true})
+			continue
+
+		case indirectExpression.MatchString(line):
+			dependencies.Indirect = true
+			continue
+		}
+
+		if matches := gemDirectiveExpression.FindStringSubmatch(line); matches != nil {
+			name := matches[1] + matches[2]
+			dependency := lockfile.Dependency{Name: name, Pinned: pinned}
+
+			for _, argument := range rubyArgumentExpression.FindAllStringSubmatch(matches[3], -1) {
+				key := argument[1] + argument[2]
+				value := strings.TrimSpace(argument[3] + argument[4])
+
+				switch {
+				case key == "" && gemRequirementExpression.MatchString(value):
+					dependency.Requirements = append(dependency.Requirements, value)
+				case slices.Contains(gemSourceOptions, key):
+					dependency.Pinned = true
+				}
+			}
+
+			if conditional || modifierExpression.MatchString(matches[3]) {
+				dependencies.Conditional = append(dependencies.Conditional, name)
+				continue
+			}
+
+			dependencies.Dependencies = append(dependencies.Dependencies, dependency)
+			continue
+		}
+
+		if matches := blockStartExpression.FindStringSubmatch(line); matches != nil {
+			blocks = append(blocks, block{
+				pinned:      slices.Contains(gemSourceOptions, matches[1]),
+				conditional: slices.Contains(conditionalBlocks, matches[1]),
+			})
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return GemfileDependencies{}, fmt.Errorf("failed to parse Gemfile: %w", err)
+	}
+
+	return dependencies, nil
+}
+
+// DependencyDrift lists the differences between the dependencies declared in
+// the Gemfile and those recorded in the DEPENDENCIES section of the lockfile.
+type DependencyDrift struct {
+	Added   []lockfile.Dependency
+	Removed []lockfile.Dependency
+	Changed []DependencyChange
+}
+
+// DependencyChange is a dependency whose requirements in the Gemfile differ
+// from those recorded in the lockfile.
+type DependencyChange struct {
+	Name     string
+	Gemfile  []string
+	Lockfile []string
+}
+
+// CompareDependencies compares the dependencies declared in the Gemfile with
+// the DEPENDENCIES section of the lockfile. Conditional gems are not compared
+// and, when the Gemfile declares dependencies indirectly, lockfile
+// dependencies missing from the Gemfile are not reported as removed.
+//
+// Requirements are compared as sets, treating a bare version as an exact
+// requirement and ignoring the implicit ">= 0" requirement.
+func CompareDependencies(gemfile GemfileDependencies, locked []lockfile.Dependency) DependencyDrift {
+	lockedByName := map[string]lockfile.Dependency{}
+	for _, dependency := range locked {
+		lockedByName[dependency.Name] = dependency
+	}
+
+	var drift DependencyDrift
+	declared := map[string]bool{}
+	for _, dependency := range gemfile.Dependencies {
+		declared[dependency.Name] = true
+
+		lockedDependency, ok := lockedByName[dependency.Name]
+		if !ok {
+			drift.Added = append(drift.Added, dependency)
+			continue
+		}
+
+		gemfileRequirements := normalizeRequirements(dependency.Requirements)
+		lockfileRequirements := normalizeRequirements(lockedDependency.Requirements)
+		if !slices.Equal(gemfileRequirements, lockfileRequirements) {
+			drift.Changed = append(drift.Changed, DependencyChange{
+				Name:     dependency.Name,
+				Gemfile:  gemfileRequirements,
+				Lockfile: lockfileRequirements,
+			})
+		}
+	}
+
+	if !gemfile.Indirect {
+		for _, dependency := range locked {
+			if !declared[dependency.Name] && !slices.Contains(gemfile.Conditional, dependency.Name) {
+				drift.Removed = append(drift.Removed, dependency)
+			}
+		}
+	}
+
+	return drift
+}
+
+// Empty returns true when there are no differences.
+func (d DependencyDrift) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String returns the differences as a diff of the DEPENDENCIES section, where
+// each line is prefixed with "+" for gems added to the Gemfile, "-" for gems
+// removed from the Gemfile and "~" for gems whose requirements changed.
+func (d DependencyDrift) String() string {
+	var lines []string
+	for _, dependency := range d.Added {
+		lines = append(lines, fmt.Sprintf("+ %s", formatDependency(dependency.Name, normalizeRequirements(dependency.Requirements))))
+	}
+
+	for _, dependency := range d.Removed {
+		lines = append(lines, fmt.Sprintf("- %s", formatDependency(dependency.Name, normalizeRequirements(dependency.Requirements))))
+	}
+
+	for _, change := range d.Changed {
+		lines = append(lines, fmt.Sprintf("~ %s, locked as %s", formatDependency(change.Name, change.Gemfile), formatDependency(change.Name, change.Lockfile)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func formatDependency(name string, requirements []string) string {
+	if len(requirements) == 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s (%s)", name, strings.Join(requirements, ", "))
+}
+
+func normalizeRequirements(requirements []string) []string {
+	var normalized []string
+	for _, requirement := range requirements {
+		requirement = strings.Join(strings.Fields(requirement), " ")
+
+		operator, version, ok := strings.Cut(requirement, " ")
+		if !ok {
+			operator, version = "=", requirement
+			for _, prefix := range []string{"~>", "<=", ">=", "!=", "<", ">", "="} {
+				if strings.HasPrefix(requirement, prefix) {
+					operator, version = prefix, strings.TrimPrefix(requirement, prefix)
+					break
+				}
+			}
+		}
+
+		requirement = fmt.Sprintf("%s %s", operator, version)
+		if requirement == ">= 0" {
+			continue
+		}
+
+		normalized = append(normalized, requirement)
+	}
+	sort.Strings(normalized)
+
+	return normalized
+}
@@ -0,0 +1,216 @@
+package bundleinstall_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGemfileDependencies(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path   string
+		parser bundleinstall.GemfileParser
+	)
+
+	it.Before(func() {
+		file, err := os.CreateTemp("", "Gemfile")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+
+		path = file.Name()
+
+		parser = bundleinstall.NewGemfileParser()
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(path)).To(Succeed())
+	})
+
+	context("ParseDependencies", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(path, []byte(`source "https://rubygems.org"
+
+ruby "3.2.2"
+
+gem "rails", "~> 7.1.0", ">= 7.1.2"
+gem 'puma', '6.4.0' # the web server
+gem("pg")
+# gem "mysql2"
+gem "sidekiq", require: false
+gem "rack-mini-profiler", github: "MiniProfiler/rack-mini-profiler"
+
+group :development, :test do
+  gem "rspec-rails"
+end
+
+git "https://github.com/rails/sprockets.git" do
+  gem "sprockets"
+end
+
+if ENV["WITH_BOOTSNAP"]
+  gem "bootsnap"
+end
+
+gem "newrelic_rpm" if ENV["NEW_RELIC"]
+
+install_if -> { RUBY_PLATFORM =~ /darwin/ } do
+  gem "terminal-notifier"
+end
+
+gem "rubocop"
+`), 0644)).To(Succeed())
+		})
+
+		it("returns the declared gems and their requirements", func() {
+			dependencies, err := parser.ParseDependencies(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dependencies).To(Equal(bundleinstall.GemfileDependencies{
+				Dependencies: []lockfile.Dependency{
+					{Name: "rails", Requirements: []string{"~> 7.1.0", ">= 7.1.2"}},
+					{Name: "puma", Requirements: []string{"6.4.0"}},
+					{Name: "pg"},
+					{Name: "sidekiq"},
+					{Name: "rack-mini-profiler", Pinned: true},
+					{Name: "rspec-rails"},
+					{Name: "sprockets", Pinned: true},
+					{Name: "rubocop"},
+				},
+				Conditional: []string{"bootsnap", "newrelic_rpm", "terminal-notifier"},
+			}))
+		})
+
+		context("when the requirements have more segments, prereleases or span several lines", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(path, []byte(`source "https://rubygems.org"
+
+gem "rails", "~> 7.0.8.1"
+gem "nokogiri", ">= 1.16.0.rc1"
+gem "puma",
+  "~> 6.4" # the web server
+gem "pg",
+  "~> 1.5",
+  require: false
+`), 0644)).To(Succeed())
+			})
+
+			it("returns their requirements", func() {
+				dependencies, err := parser.ParseDependencies(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dependencies.Dependencies).To(Equal([]lockfile.Dependency{
+					{Name: "rails", Requirements: []string{"~> 7.0.8.1"}},
+					{Name: "nokogiri", Requirements: []string{">= 1.16.0.rc1"}},
+					{Name: "puma", Requirements: []string{"~> 6.4"}},
+					{Name: "pg", Requirements: []string{"~> 1.5"}},
+				}))
+
+				drift := bundleinstall.CompareDependencies(dependencies, []lockfile.Dependency{
+					{Name: "nokogiri", Requirements: []string{">= 1.16.0.rc1"}},
+					{Name: "pg", Requirements: []string{"~> 1.5"}},
+					{Name: "puma", Requirements: []string{"~> 6.4"}},
+					{Name: "rails", Requirements: []string{"~> 7.0.8.1"}},
+				})
+				Expect(drift.Empty()).To(BeTrue())
+			})
+		})
+
+		context("when the Gemfile declares dependencies indirectly", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(path, []byte("source 'https://rubygems.org'\n\ngemspec\n\neval_gemfile 'Gemfile.local'\n"), 0644)).To(Succeed())
+			})
+
+			it("reports that the dependencies are indirect", func() {
+				dependencies, err := parser.ParseDependencies(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dependencies.Indirect).To(BeTrue())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the Gemfile does not exist", func() {
+				it.Before(func() {
+					Expect(os.Remove(path)).To(Succeed())
+				})
+
+				it("returns an ErrNotExist error", func() {
+					_, err := parser.ParseDependencies(path)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse Gemfile:")))
+					Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+				})
+			})
+		})
+	})
+
+	context("CompareDependencies", func() {
+		var locked []lockfile.Dependency
+
+		it.Before(func() {
+			locked = []lockfile.Dependency{
+				{Name: "pg"},
+				{Name: "puma", Requirements: []string{"= 6.4.0"}},
+				{Name: "rails", Requirements: []string{">= 7.1.2", "~> 7.1.0"}},
+				{Name: "sidekiq", Requirements: []string{">= 0"}},
+				{Name: "bootsnap"},
+			}
+		})
+
+		it("finds no drift when the requirements match", func() {
+			drift := bundleinstall.CompareDependencies(bundleinstall.GemfileDependencies{
+				Dependencies: []lockfile.Dependency{
+					{Name: "rails", Requirements: []string{"~> 7.1.0", ">= 7.1.2"}},
+					{Name: "puma", Requirements: []string{"6.4.0"}},
+					{Name: "pg"},
+					{Name: "sidekiq"},
+				},
+				Conditional: []string{"bootsnap"},
+			}, locked)
+			Expect(drift.Empty()).To(BeTrue())
+		})
+
+		it("returns the added, removed and changed dependencies", func() {
+			drift := bundleinstall.CompareDependencies(bundleinstall.GemfileDependencies{
+				Dependencies: []lockfile.Dependency{
+					{Name: "rails", Requirements: []string{"~> 7.2.0"}},
+					{Name: "puma", Requirements: []string{"6.4.0"}},
+					{Name: "sidekiq"},
+					{Name: "redis", Requirements: []string{">=5"}},
+				},
+			}, locked)
+			Expect(drift).To(Equal(bundleinstall.DependencyDrift{
+				Added: []lockfile.Dependency{
+					{Name: "redis", Requirements: []string{">=5"}},
+				},
+				Removed: []lockfile.Dependency{
+					{Name: "pg"},
+					{Name: "bootsnap"},
+				},
+				Changed: []bundleinstall.DependencyChange{
+					{
+						Name:     "rails",
+						Gemfile:  []string{"~> 7.2.0"},
+						Lockfile: []string{">= 7.1.2", "~> 7.1.0"},
+					},
+				},
+			}))
+			Expect(drift.Empty()).To(BeFalse())
+			Expect(drift.String()).To(Equal(`+ redis (>= 5)
+- pg
+- bootsnap
+~ rails (~> 7.2.0), locked as rails (>= 7.1.2, ~> 7.1.0)`))
+		})
+
+		it("does not report removed dependencies when the Gemfile declares dependencies indirectly", func() {
+			drift := bundleinstall.CompareDependencies(bundleinstall.GemfileDependencies{
+				Indirect: true,
+			}, locked)
+			Expect(drift.Empty()).To(BeTrue())
+		})
+	})
+}
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 )
 
 // GemfileParser parses the Gemfile to determine the version of Ruby used by
@@ -18,25 +20,111 @@ func NewGemfileParser() GemfileParser {
 
 const versionNumberExpression = `\d+(\.\d+)?(\.\d+)?`
 
+var (
+	rubyDirectiveExpression  = regexp.MustCompile(`^\s*ruby(?:\s+|\s*\()(.*)$`)
+	rubyArgumentExpression   = regexp.MustCompile(`(?:(\w+):\s*|:(\w+)\s*=>\s*)?(?:"([^"]*)"|'([^']*)')`)
+	rubyConstraintExpression = regexp.MustCompile(fmt.Sprintf(`^(~>|<=|>=|!=|<|>|=)?\s*%s$`, versionNumberExpression))
+)
+
 // ParseVersion scans the Gemfile for a Ruby version specification.
+//
+// The version is taken from the first "ruby" directive that is not commented
+// out. Multiple version constraints, such as `ruby ">= 3.1", "< 3.4"`, are
+// combined into a single comma-separated constraint. A `ruby file:` directive
+// is followed to the referenced version file, relative to the Gemfile.
 func (p GemfileParser) ParseVersion(path string) (string, error) {
-	file, err := os.Open(path)
+	directive, err := parseRubyDirective(path)
+	if err != nil {
+		return "", err
+	}
+
+	if file, ok := directive.options["file"]; ok {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+
+		version, err := NewRubyVersionFileParser().ParseVersion(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse Ruby version from Gemfile ruby file: directive: %w", err)
+		}
+
+		return version, nil
+	}
+
+	return strings.Join(directive.constraints, ", "), nil
+}
+
+// ParseEngine scans the Gemfile for the Ruby engine, such as "jruby", given
+// by the engine and engine_version options of the "ruby" directive. If no
+// engine is given, the engine is empty.
+func (p GemfileParser) ParseEngine(path string) (string, string, error) {
+	directive, err := parseRubyDirective(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse Gemfile: %w", err)
+		return "", "", err
 	}
 
-	quotes := `["']`
-	versionOperators := `~>|<|>|<=|>=|=`
-	expression := fmt.Sprintf(`ruby %s((%s)?\s*%s)%s`, quotes, versionOperators, versionNumberExpression, quotes)
-	re := regexp.MustCompile(expression)
+	return directive.options["engine"], directive.options["engine_version"], nil
+}
+
+type rubyDirective struct {
+	constraints []string
+	options     map[string]string
+}
+
+// parseRubyDirective finds the first "ruby" directive in the Gemfile that is
+// not commented out and declares either a version constraint or a file
+// option.
+func parseRubyDirective(path string) (rubyDirective, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return rubyDirective{}, fmt.Errorf("failed to parse Gemfile: %w", err)
+	}
+	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		matches := re.FindStringSubmatch(scanner.Text())
-		if len(matches) >= 3 {
-			return matches[1], nil
+		matches := rubyDirectiveExpression.FindStringSubmatch(stripRubyComment(scanner.Text()))
+		if matches == nil {
+			continue
+		}
+
+		directive := rubyDirective{options: map[string]string{}}
+		for _, argument := range rubyArgumentExpression.FindAllStringSubmatch(matches[1], -1) {
+			key := argument[1] + argument[2]
+			value := strings.TrimSpace(argument[3] + argument[4])
+
+			if key != "" {
+				directive.options[key] = value
+				continue
+			}
+
+			if rubyConstraintExpression.MatchString(value) {
+				directive.constraints = append(directive.constraints, value)
+			}
+		}
+
+		if _, ok := directive.options["file"]; ok || len(directive.constraints) > 0 {
+			return directive, nil
+		}
+	}
+
+	return rubyDirective{}, nil
+}
+
+// stripRubyComment removes a trailing comment from a line of Ruby code,
+// ignoring any "#" characters that appear inside of string literals.
+func stripRubyComment(line string) string {
+	var quote rune
+	for i, char := range line {
+		switch {
+		case quote != 0 && char == quote:
+			quote = 0
+		case quote == 0 && (char == '"' || char == '\''):
+			quote = char
+		case quote == 0 && char == '#':
+			return line[:i]
 		}
 	}
 
-	return "", nil
+	return line
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -78,6 +79,87 @@ func testGemfileParser(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("when the ruby directive is commented out", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(path, []byte(`source 'https://rubygems.org'
+
+# ruby "2.7"
+  # ruby "2.6"
+ruby "3.2.2" # the version used in production
+`), 0644)).To(Succeed())
+			})
+
+			it("skips the commented out lines", func() {
+				version, err := parser.ParseVersion(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(version).To(Equal("3.2.2"))
+			})
+		})
+
+		context("when the ruby directive has multiple constraints", func() {
+			it("combines them into a single constraint", func() {
+				for _, directive := range []string{
+					`">= 3.1", "< 3.4"`,
+					`'>= 3.1', '< 3.4'`,
+					`(">= 3.1", "< 3.4")`,
+				} {
+					Expect(os.WriteFile(path, []byte(fmt.Sprintf(GEMFILE_TEMPLATE, directive)), 0644)).To(Succeed())
+
+					version, err := parser.ParseVersion(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(version).To(Equal(">= 3.1, < 3.4"))
+				}
+			})
+		})
+
+		context("when the ruby directive has other options", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(path, []byte(fmt.Sprintf(GEMFILE_TEMPLATE, `"3.2.2", patchlevel: "53"`)), 0644)).To(Succeed())
+			})
+
+			it("ignores them", func() {
+				version, err := parser.ParseVersion(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(version).To(Equal("3.2.2"))
+			})
+		})
+
+		context("when the ruby directive references a version file", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(filepath.Dir(path), ".ruby-version"), []byte("ruby-3.3.0\n"), 0644)).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.RemoveAll(filepath.Join(filepath.Dir(path), ".ruby-version"))).To(Succeed())
+			})
+
+			it("reads the version from that file relative to the Gemfile", func() {
+				for _, directive := range []string{
+					`file: ".ruby-version"`,
+					`(file: '.ruby-version')`,
+					`:file => ".ruby-version"`,
+				} {
+					Expect(os.WriteFile(path, []byte(fmt.Sprintf(GEMFILE_TEMPLATE, directive)), 0644)).To(Succeed())
+
+					version, err := parser.ParseVersion(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(version).To(Equal("3.3.0"))
+				}
+			})
+		})
+
+		context("when the Gemfile has no ruby directive", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(path, []byte("source 'https://rubygems.org'\n\ngem 'ruby-progressbar'\ngem 'rubocop'\n"), 0644)).To(Succeed())
+			})
+
+			it("returns an empty version", func() {
+				version, err := parser.ParseVersion(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(version).To(BeEmpty())
+			})
+		})
+
 		context("when the Gemfile file does not exist", func() {
 			it.Before(func() {
 				Expect(os.Remove(path)).To(Succeed())
@@ -101,6 +183,73 @@ func testGemfileParser(t *testing.T, context spec.G, it spec.S) {
 					Expect(err).To(MatchError(ContainSubstring("permission denied")))
 				})
 			})
+
+			context("when the referenced version file does not exist", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(path, []byte(fmt.Sprintf(GEMFILE_TEMPLATE, `file: ".no-such-version"`)), 0644)).To(Succeed())
+				})
+
+				it("returns an ErrNotExist error", func() {
+					_, err := parser.ParseVersion(path)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse Ruby version from Gemfile ruby file: directive")))
+					Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+				})
+			})
+		})
+	})
+
+	context("ParseEngine", func() {
+		context("when the ruby directive declares an engine", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(path, []byte(fmt.Sprintf(GEMFILE_TEMPLATE, `"3.1.4", engine: "jruby", engine_version: "9.4.5.0"`)), 0644)).To(Succeed())
+			})
+
+			it("returns the engine and its version", func() {
+				engine, engineVersion, err := parser.ParseEngine(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(engine).To(Equal("jruby"))
+				Expect(engineVersion).To(Equal("9.4.5.0"))
+			})
+		})
+
+		context("when the ruby directive uses hash rocket options", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(path, []byte(fmt.Sprintf(GEMFILE_TEMPLATE, `'3.2.2', :engine => 'truffleruby', :engine_version => '23.1.1'`)), 0644)).To(Succeed())
+			})
+
+			it("returns the engine and its version", func() {
+				engine, engineVersion, err := parser.ParseEngine(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(engine).To(Equal("truffleruby"))
+				Expect(engineVersion).To(Equal("23.1.1"))
+			})
+		})
+
+		context("when the ruby directive does not declare an engine", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(path, []byte(fmt.Sprintf(GEMFILE_TEMPLATE, `"3.2.2"`)), 0644)).To(Succeed())
+			})
+
+			it("returns an empty engine", func() {
+				engine, engineVersion, err := parser.ParseEngine(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(engine).To(BeEmpty())
+				Expect(engineVersion).To(BeEmpty())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the Gemfile cannot be opened", func() {
+				it.Before(func() {
+					Expect(os.Chmod(path, 0000)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, _, err := parser.ParseEngine(path)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse Gemfile:")))
+					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+				})
+			})
 		})
 	})
 }
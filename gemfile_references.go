@@ -0,0 +1,202 @@
+package bundleinstall
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+)
+
+var (
+	evalGemfileExpression = regexp.MustCompile(`^\s*eval_gemfile(?:\s+|\s*\()(.*)$`)
+	gemspecExpression     = regexp.MustCompile(`^\s*gemspec\b(.*)$`)
+	pathBlockExpression   = regexp.MustCompile(`^\s*path(?:\s+|\s*\()(.*)$`)
+)
+
+// GemfileReferences is the set of files and directories, other than the
+// lockfile, that a Gemfile refers to.
+type GemfileReferences struct {
+	// EvalGemfiles is the set of Gemfiles evaluated through "eval_gemfile",
+	// including those evaluated by such Gemfiles in turn.
+	EvalGemfiles []string
+
+	// Paths is the set of directories of gems installed from a local path,
+	// through a "path" option or block, or through "gemspec".
+	Paths []string
+}
+
+// ParseReferences scans the Gemfile, and the Gemfiles it evaluates, for the
+// files and directories it refers to. Relative paths are resolved against the
+// directory of the Gemfile that refers to them.
+//
+// As with ParseDependencies, the Gemfile is not evaluated, so only references
+// given as literal strings are understood. Evaluated Gemfiles that do not
+// exist are left for Bundler to report.
+func (p GemfileParser) ParseReferences(path string) (GemfileReferences, error) {
+	var references GemfileReferences
+	err := p.parseReferences(path, &references, map[string]bool{path: true})
+	if err != nil {
+		return GemfileReferences{}, err
+	}
+
+	return references, nil
+}
+
+func (p GemfileParser) parseReferences(path string, references *GemfileReferences, seen map[string]bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to parse Gemfile: %w", err)
+	}
+	defer file.Close()
+
+	resolve := func(reference string) string {
+		if filepath.IsAbs(reference) {
+			return filepath.Clean(reference)
+		}
+
+		return filepath.Join(filepath.Dir(path), reference)
+	}
+
+	var evalGemfiles []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := stripRubyComment(scanner.Text())
+
+		if matches := evalGemfileExpression.FindStringSubmatch(line); matches != nil {
+			if reference, ok := firstRubyString(matches[1]); ok {
+				evalGemfiles = append(evalGemfiles, resolve(reference))
+			}
+			continue
+		}
+
+		if matches := gemspecExpression.FindStringSubmatch(line); matches != nil {
+			reference := "."
+			for _, argument := range rubyArgumentExpression.FindAllStringSubmatch(matches[1], -1) {
+				if argument[1]+argument[2] == "path" {
+					reference = argument[3] + argument[4]
+				}
+			}
+
+			references.Paths = appendUnique(references.Paths, resolve(reference))
+			continue
+		}
+
+		if matches := pathBlockExpression.FindStringSubmatch(line); matches != nil {
+			if reference, ok := firstRubyString(matches[1]); ok {
+				references.Paths = appendUnique(references.Paths, resolve(reference))
+			}
+			continue
+		}
+
+		if matches := gemDirectiveExpression.FindStringSubmatch(line); matches != nil {
+			for _, argument := range rubyArgumentExpression.FindAllStringSubmatch(matches[3], -1) {
+				if argument[1]+argument[2] == "path" {
+					references.Paths = appendUnique(references.Paths, resolve(argument[3]+argument[4]))
+				}
+			}
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to parse Gemfile: %w", err)
+	}
+
+	for _, evalGemfile := range evalGemfiles {
+		if seen[evalGemfile] {
+			continue
+		}
+		seen[evalGemfile] = true
+
+		err = p.parseReferences(evalGemfile, references, seen)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return err
+		}
+
+		references.EvalGemfiles = append(references.EvalGemfiles, evalGemfile)
+	}
+
+	return nil
+}
+
+// firstRubyString returns the first argument of a method call when it is a
+// literal string.
+func firstRubyString(arguments string) (string, bool) {
+	argument := rubyArgumentExpression.FindStringSubmatch(arguments)
+	if argument == nil || argument[1]+argument[2] != "" {
+		return "", false
+	}
+
+	if !strings.HasPrefix(strings.TrimSpace(arguments), strings.TrimSpace(argument[0])) {
+		return "", false
+	}
+
+	return argument[3] + argument[4], true
+}
+
+func appendUnique(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+
+	return append(values, value)
+}
+
+// referencedFiles returns the Gemfiles evaluated by the Gemfile of the
+// manifest, and the gemspecs of the gems it installs from a local path. The
+// path gems are taken from both the Gemfile and the PATH sections of the
+// lockfile, and must be located within the application directory as nothing
+// else is available in the build container.
+func (ip BundleInstallProcess) referencedFiles(workingDir string, manifest Manifest) ([]string, error) {
+	references, err := ip.gemfileParser.ParseReferences(manifest.Gemfile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if manifest.Locked {
+		lock, err := ip.lockfileParser.Parse(manifest.Lockfile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, source := range lock.Sources {
+			if source.Type != lockfile.SourceTypePath || source.Remote() == "" {
+				continue
+			}
+
+			path := source.Remote()
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(manifest.Gemfile), path)
+			}
+
+			references.Paths = appendUnique(references.Paths, filepath.Clean(path))
+		}
+	}
+
+	files := references.EvalGemfiles
+	for _, path := range references.Paths {
+		relative, err := filepath.Rel(workingDir, path)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("failed to locate path gem: %s is outside of the application directory %s and does not exist in the build container, move the gem into the application directory", path, workingDir)
+		}
+
+		gemspecs, err := filepath.Glob(filepath.Join(path, "*.gemspec"))
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, gemspecs...)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,81 @@
+package bundleinstall_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGemfileReferences(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		parser     bundleinstall.GemfileParser
+	)
+
+	it.Before(func() {
+		workingDir = t.TempDir()
+		parser = bundleinstall.NewGemfileParser()
+	})
+
+	context("ParseReferences", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte(`source "https://rubygems.org"
+
+gemspec
+
+gem "rails"
+gem "billing", path: "engines/billing"
+gem "auth", :path => "/workspace/engines/auth"
+# gem "legacy", path: "engines/legacy"
+
+path "components" do
+  gem "search"
+end
+
+eval_gemfile "Gemfile.shared"
+eval_gemfile File.join(__dir__, "Gemfile.dynamic")
+eval_gemfile "Gemfile.missing"
+`), 0600)).To(Succeed())
+
+			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.shared"), []byte(`gemspec path: "shared", name: "shared"
+
+eval_gemfile "Gemfile"
+`), 0600)).To(Succeed())
+		})
+
+		it("returns the evaluated Gemfiles and path gem directories", func() {
+			references, err := parser.ParseReferences(filepath.Join(workingDir, "Gemfile"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(references).To(Equal(bundleinstall.GemfileReferences{
+				EvalGemfiles: []string{
+					filepath.Join(workingDir, "Gemfile.shared"),
+				},
+				Paths: []string{
+					workingDir,
+					filepath.Join(workingDir, "engines", "billing"),
+					"/workspace/engines/auth",
+					filepath.Join(workingDir, "components"),
+					filepath.Join(workingDir, "shared"),
+				},
+			}))
+		})
+
+		context("failure cases", func() {
+			context("when the Gemfile does not exist", func() {
+				it("returns an ErrNotExist error", func() {
+					_, err := parser.ParseReferences(filepath.Join(workingDir, "gems.rb"))
+					Expect(err).To(MatchError(ContainSubstring("failed to parse Gemfile:")))
+					Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,220 @@
+package bundleinstall
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// GitSourceCache verifies the bare clones of git sources that Bundler keeps
+// in its user cache, so that they can be reused across builds.
+type GitSourceCache struct {
+	executable Executable
+	logger     scribe.Emitter
+}
+
+// NewGitSourceCache initializes an instance of GitSourceCache.
+func NewGitSourceCache(executable Executable, logger scribe.Emitter) GitSourceCache {
+	return GitSourceCache{
+		executable: executable,
+		logger:     logger,
+	}
+}
+
+// Verify checks that the bare clones at the given path contain the revisions
+// locked for the GIT sources of the given lockfile. Bundler names each clone
+// after the base name of its repository followed by the SHA-1 digest of its
+// URI, so every clone of a repository with that base name is considered, but
+// not the clones of other repositories whose names merely share it as a
+// prefix.
+//
+// A clone is reused when it contains the locked revision. Otherwise, the
+// branches and tags of the repository are fetched into the clone, and an error
+// is returned if the locked revision is still missing. A clone that is no
+// longer a valid repository is removed so that Bundler clones the repository
+// again, as it does for repositories with no clone. An error is returned when
+// git cannot be run at all, rather than mistaking every clone for an invalid
+// one.
+func (c GitSourceCache) Verify(path string, lock lockfile.Lockfile) error {
+	var sources []lockfile.Source
+	for _, source := range lock.Sources {
+		if source.Type == lockfile.SourceTypeGit && source.Remote() != "" && source.Revision != "" {
+			sources = append(sources, source)
+		}
+	}
+
+	if len(sources) == 0 {
+		return nil
+	}
+
+	c.logger.Process("Verifying cached git sources")
+	for _, source := range sources {
+		clones, err := gitClones(path, source.Remote())
+		if err != nil {
+			return err
+		}
+
+		status := "not cached, cloning"
+		for _, clone := range clones {
+			output, ok, err := c.git(clone, "rev-parse", "--is-bare-repository")
+			if err != nil {
+				return err
+			}
+
+			if !ok || strings.TrimSpace(output) != "true" {
+				c.logger.Debug.Subprocess("Removing invalid clone %s", clone)
+				err = os.RemoveAll(clone)
+				if err != nil {
+					return fmt.Errorf("failed to remove invalid git clone: %w", err)
+				}
+
+				continue
+			}
+
+			ok, err = c.contains(clone, source.Revision)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				status = "reusing cached clone"
+				break
+			}
+
+			output, ok, err = c.git(clone, "fetch", "--force", "--quiet", "--no-tags", source.Remote(), "refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*")
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				return fmt.Errorf("failed to fetch git source %s:\n%s", source.Remote(), output)
+			}
+
+			ok, err = c.contains(clone, source.Revision)
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				return fmt.Errorf("failed to fetch git source %s: revision %s not found in the repository", source.Remote(), source.Revision)
+			}
+
+			status = "fetched missing revision"
+			break
+		}
+
+		c.logger.Subprocess("%s at %s: %s", source.Remote(), shortRevision(source.Revision), status)
+	}
+	c.logger.Break()
+
+	return nil
+}
+
+// contains returns true if the given revision resolves to a commit in the
+// given clone.
+func (c GitSourceCache) contains(clone, revision string) (bool, error) {
+	_, ok, err := c.git(clone, "rev-parse", "--verify", "--quiet", fmt.Sprintf("%s^{commit}", revision))
+	return ok, err
+}
+
+// git runs git against the given clone, and returns its output along with
+// whether it succeeded. An error is only returned when git could not be run,
+// rather than exiting with a non-zero status.
+func (c GitSourceCache) git(clone string, args ...string) (string, bool, error) {
+	buffer := bytes.NewBuffer(nil)
+	err := c.executable.Execute(pexec.Execution{
+		Args:   append([]string{"--git-dir", clone}, args...),
+		Stdout: buffer,
+		Stderr: buffer,
+	})
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return buffer.String(), false, nil
+		}
+
+		return "", false, fmt.Errorf("failed to run git: %w", err)
+	}
+
+	return buffer.String(), true, nil
+}
+
+// gitClones returns the clones at the given path that Bundler could have made
+// of the repository at the given URI, being those named after its base name
+// followed by a hex-encoded SHA-1 digest.
+func gitClones(path, uri string) ([]string, error) {
+	name := regexp.MustCompile(fmt.Sprintf(`^%s-[0-9a-f]{40}$`, regexp.QuoteMeta(gitBaseName(uri))))
+
+	matches, err := filepath.Glob(filepath.Join(path, fmt.Sprintf("%s-*", gitBaseName(uri))))
+	if err != nil {
+		return nil, err
+	}
+
+	var clones []string
+	for _, match := range matches {
+		if name.MatchString(filepath.Base(match)) {
+			clones = append(clones, match)
+		}
+	}
+
+	return clones, nil
+}
+
+// gitBaseName returns the name of the repository at the given URI, as used by
+// Bundler to name its clone, such that "git@github.com:org/repo.git" is named
+// "repo".
+func gitBaseName(uri string) string {
+	name := strings.TrimSuffix(uri, "/")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return strings.TrimSuffix(name, ".git")
+}
+
+func shortRevision(revision string) string {
+	if len(revision) > 12 {
+		return revision[:12]
+	}
+
+	return revision
+}
+
+// linkGitCache links the "git" directory of the Bundler user cache at the
+// given path to the given directory, so that Bundler keeps its clones of git
+// sources there.
+func linkGitCache(userCachePath, gitCachePath string) error {
+	link := filepath.Join(userCachePath, "git")
+	target, err := os.Readlink(link)
+	if err == nil && target == gitCachePath {
+		return nil
+	}
+
+	for _, path := range []string{userCachePath, gitCachePath} {
+		err = os.MkdirAll(path, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("failed to link git cache: %w", err)
+		}
+	}
+
+	err = os.RemoveAll(link)
+	if err != nil {
+		return fmt.Errorf("failed to link git cache: %w", err)
+	}
+
+	err = os.Symlink(gitCachePath, link)
+	if err != nil {
+		return fmt.Errorf("failed to link git cache: %w", err)
+	}
+
+	return nil
+}
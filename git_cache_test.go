@@ -0,0 +1,278 @@
+package bundleinstall_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/paketo-buildpacks/bundle-install/fakes"
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+	. "github.com/paketo-buildpacks/occam/matchers"
+)
+
+func testGitCache(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path       string
+		lock       lockfile.Lockfile
+		executions []pexec.Execution
+		executable *fakes.Executable
+		buffer     *bytes.Buffer
+		revisions  map[string]string
+		fetched    map[string]string
+
+		gitCache bundleinstall.GitSourceCache
+	)
+
+	it.Before(func() {
+		path = t.TempDir()
+		Expect(os.MkdirAll(filepath.Join(path, "some-gem-0123456789abcdef0123456789abcdef01234567"), os.ModePerm)).To(Succeed())
+
+		lock = lockfile.Lockfile{
+			Sources: []lockfile.Source{
+				{
+					Type:     lockfile.SourceTypeGit,
+					Remotes:  []string{"https://github.com/some-org/some-gem.git"},
+					Revision: "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678",
+				},
+				{
+					Type:    lockfile.SourceTypeGem,
+					Remotes: []string{"https://rubygems.org/"},
+				},
+			},
+		}
+
+		revisions = map[string]string{
+			"a1b2c3d4e5f60718293a4b5c6d7e8f9012345678^{commit}": "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678",
+		}
+		fetched = map[string]string{}
+
+		executions = nil
+		executable = &fakes.Executable{}
+		executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+			executions = append(executions, execution)
+
+			switch {
+			case execution.Args[2] == "fetch":
+				for key, value := range fetched {
+					revisions[key] = value
+				}
+
+			case execution.Args[3] == "--is-bare-repository":
+				_, err := fmt.Fprintln(execution.Stdout, "true")
+				return err
+
+			case execution.Args[3] == "--verify":
+				revision, ok := revisions[execution.Args[5]]
+				if !ok {
+					return &exec.ExitError{}
+				}
+
+				_, err := fmt.Fprintln(execution.Stdout, revision)
+				return err
+			}
+
+			return nil
+		}
+
+		buffer = bytes.NewBuffer(nil)
+		gitCache = bundleinstall.NewGitSourceCache(executable, scribe.NewEmitter(buffer))
+	})
+
+	context("Verify", func() {
+		it("reuses the cached clone that contains the locked revision", func() {
+			err := gitCache.Verify(path, lock)
+			Expect(err).NotTo(HaveOccurred())
+
+			clone := filepath.Join(path, "some-gem-0123456789abcdef0123456789abcdef01234567")
+			Expect(executions).To(HaveLen(2))
+			Expect(executions[0].Args).To(Equal([]string{"--git-dir", clone, "rev-parse", "--is-bare-repository"}))
+			Expect(executions[1].Args).To(Equal([]string{"--git-dir", clone, "rev-parse", "--verify", "--quiet", "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678^{commit}"}))
+
+			Expect(buffer).To(ContainLines(
+				"  Verifying cached git sources",
+				"    https://github.com/some-org/some-gem.git at a1b2c3d4e5f6: reusing cached clone",
+			))
+		})
+
+		context("when the locked revision is not cached", func() {
+			it.Before(func() {
+				fetched = revisions
+				revisions = map[string]string{}
+			})
+
+			it("fetches it into the cached clone", func() {
+				err := gitCache.Verify(path, lock)
+				Expect(err).NotTo(HaveOccurred())
+
+				clone := filepath.Join(path, "some-gem-0123456789abcdef0123456789abcdef01234567")
+				Expect(executions).To(HaveLen(4))
+				Expect(executions[2].Args).To(Equal([]string{
+					"--git-dir", clone,
+					"fetch", "--force", "--quiet", "--no-tags", "https://github.com/some-org/some-gem.git",
+					"refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*",
+				}))
+				Expect(executions[3].Args).To(Equal([]string{"--git-dir", clone, "rev-parse", "--verify", "--quiet", "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678^{commit}"}))
+
+				Expect(buffer).To(ContainLines(
+					"    https://github.com/some-org/some-gem.git at a1b2c3d4e5f6: fetched missing revision",
+				))
+			})
+		})
+
+		context("when the repository has no cached clone", func() {
+			it.Before(func() {
+				lock.Sources[0].Remotes = []string{"git@github.com:some-org/other-gem.git"}
+			})
+
+			it("lets Bundler clone it", func() {
+				err := gitCache.Verify(path, lock)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(BeEmpty())
+				Expect(buffer).To(ContainLines(
+					"    git@github.com:some-org/other-gem.git at a1b2c3d4e5f6: not cached, cloning",
+				))
+			})
+		})
+
+		context("when another repository's name shares the base name as a prefix", func() {
+			it.Before(func() {
+				Expect(os.Rename(
+					filepath.Join(path, "some-gem-0123456789abcdef0123456789abcdef01234567"),
+					filepath.Join(path, "some-gem-api-0123456789abcdef0123456789abcdef01234567"),
+				)).To(Succeed())
+			})
+
+			it("leaves the clone of the other repository alone", func() {
+				err := gitCache.Verify(path, lock)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(BeEmpty())
+				Expect(filepath.Join(path, "some-gem-api-0123456789abcdef0123456789abcdef01234567")).To(BeADirectory())
+				Expect(buffer).To(ContainLines(
+					"    https://github.com/some-org/some-gem.git at a1b2c3d4e5f6: not cached, cloning",
+				))
+			})
+		})
+
+		context("when the cached clone is not a valid repository", func() {
+			it.Before(func() {
+				executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+					executions = append(executions, execution)
+					return &exec.ExitError{}
+				}
+			})
+
+			it("removes it so that Bundler clones the repository again", func() {
+				err := gitCache.Verify(path, lock)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(path, "some-gem-0123456789abcdef0123456789abcdef01234567")).NotTo(BeADirectory())
+				Expect(buffer).To(ContainLines(
+					"    https://github.com/some-org/some-gem.git at a1b2c3d4e5f6: not cached, cloning",
+				))
+			})
+		})
+
+		context("when the lockfile has no git sources", func() {
+			it.Before(func() {
+				lock.Sources = lock.Sources[1:]
+			})
+
+			it("does nothing", func() {
+				err := gitCache.Verify(path, lock)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(BeEmpty())
+				Expect(buffer.String()).To(BeEmpty())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when git cannot be run", func() {
+				it.Before(func() {
+					executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+						return errors.New("executable file not found in $PATH")
+					}
+				})
+
+				it("returns an error and keeps the cached clone", func() {
+					err := gitCache.Verify(path, lock)
+					Expect(err).To(MatchError("failed to run git: executable file not found in $PATH"))
+
+					Expect(filepath.Join(path, "some-gem-0123456789abcdef0123456789abcdef01234567")).To(BeADirectory())
+				})
+			})
+
+			context("when the missing revision cannot be fetched", func() {
+				it.Before(func() {
+					revisions = map[string]string{}
+					executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+						switch {
+						case execution.Args[2] == "fetch":
+							_, err := fmt.Fprintln(execution.Stderr, "fatal: unable to access repository")
+							Expect(err).NotTo(HaveOccurred())
+							return &exec.ExitError{}
+
+						case execution.Args[3] == "--is-bare-repository":
+							_, err := fmt.Fprintln(execution.Stdout, "true")
+							return err
+						}
+
+						return &exec.ExitError{}
+					}
+				})
+
+				it("returns an error", func() {
+					err := gitCache.Verify(path, lock)
+					Expect(err).To(MatchError(ContainSubstring("failed to fetch git source https://github.com/some-org/some-gem.git")))
+					Expect(err).To(MatchError(ContainSubstring("fatal: unable to access repository")))
+				})
+			})
+
+			context("when the fetched repository does not contain the locked revision", func() {
+				it.Before(func() {
+					revisions = map[string]string{}
+				})
+
+				it("returns an error", func() {
+					err := gitCache.Verify(path, lock)
+					Expect(err).To(MatchError("failed to fetch git source https://github.com/some-org/some-gem.git: revision a1b2c3d4e5f60718293a4b5c6d7e8f9012345678 not found in the repository"))
+				})
+			})
+
+			context("when an invalid clone cannot be removed", func() {
+				it.Before(func() {
+					executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+						return &exec.ExitError{}
+					}
+
+					Expect(os.WriteFile(filepath.Join(path, "some-gem-0123456789abcdef0123456789abcdef01234567", "HEAD"), nil, 0600)).To(Succeed())
+					Expect(os.Chmod(path, 0500)).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Chmod(path, os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					err := gitCache.Verify(path, lock)
+					Expect(err).To(MatchError(ContainSubstring("failed to remove invalid git clone")))
+					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+				})
+			})
+		})
+	})
+}
@@ -11,10 +11,21 @@ func TestUnitBundleInstall(t *testing.T) {
 	suite := spec.New("bundle-install", spec.Report(report.Terminal{}), spec.Parallel())
 	suite("Build", testBuild)
 	suite("BundleInstallProcess", testBundleInstallProcess)
+	suite("CacheKey", testCacheKey)
 	suite("Detect", testDetect)
 	suite("Environment", testEnvironment)
+	suite("GemCache", testGemCache)
+	suite("GemGroups", testGemGroups)
+	suite("GemSet", testGemSet)
+	suite("GemTransfer", testGemTransfer)
+	suite("GemfileDependencies", testGemfileDependencies)
+	suite("GemfileReferences", testGemfileReferences)
 	suite("GemfileParser", testGemfileParser)
+	suite("GitCache", testGitCache)
+	suite("Manifest", testManifest)
 	suite("RubyVersionFileParser", testRubyVersionFileParser)
+	suite("RubyVersionCandidates", testRubyVersionCandidates)
 	suite("RubyVersionResolver", testRubyVersionResolver)
+	suite("StaleGems", testStaleGems)
 	suite.Run(t)
 }
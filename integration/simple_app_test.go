@@ -79,6 +79,8 @@ func testSimpleApp(t *testing.T, context spec.G, it spec.S) {
 			))
 			Expect(logs).To(ContainLines(
 				"  Executing build environment install process",
+				"    Installing because:",
+				"      no previous metadata",
 				"    Setting up bundle install config paths:",
 				"      Local config path: /workspace/.bundle/config",
 				"      Backup config path: /workspace/.bundle/config.bak",
@@ -105,6 +107,13 @@ func testSimpleApp(t *testing.T, context spec.G, it spec.S) {
 			))
 			Expect(logs).To(ContainLines(
 				"  Executing launch environment install process",
+				"    Installing because:",
+				"      no previous metadata",
+				"    Transferring gems from the build layer",
+				MatchRegexp(`      Reflinked \d+, hardlinked \d+ and copied \d+ files`),
+				"      Skipped 9 gem(s) outside of the launch groups",
+				MatchRegexp(`      Completed in \d+\.?\d*`),
+				"    Installing launch gems",
 				"    Setting up bundle install config paths:",
 				"      Local config path: /workspace/.bundle/config",
 				"      Backup config path: /workspace/.bundle/config.bak",
@@ -0,0 +1,15 @@
+package lockfile_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitLockfile(t *testing.T) {
+	suite := spec.New("lockfile", spec.Report(report.Terminal{}), spec.Parallel())
+	suite("Lockfile", testLockfile)
+	suite("Parser", testParser)
+	suite.Run(t)
+}
@@ -0,0 +1,173 @@
+// Package lockfile provides a native parser for the Gemfile.lock files
+// generated by Bundler.
+//
+// The parser understands every section written by modern versions of Bundler
+// (GEM, GIT, PATH, PLUGIN SOURCE, PLATFORMS, DEPENDENCIES, CHECKSUMS, RUBY
+// VERSION and BUNDLED WITH) and exposes them as a Lockfile so that the locked
+// dependency graph can be inspected without starting Ruby.
+package lockfile
+
+import "strings"
+
+const (
+	// SourceTypeGem is the section header for gems installed from a gem
+	// server, such as https://rubygems.org.
+	SourceTypeGem = "GEM"
+
+	// SourceTypeGit is the section header for gems installed from a git
+	// repository.
+	SourceTypeGit = "GIT"
+
+	// SourceTypePath is the section header for gems installed from a local
+	// path, including those declared using the "gemspec" directive.
+	SourceTypePath = "PATH"
+
+	// SourceTypePlugin is the section header for gems installed using a
+	// Bundler source plugin.
+	SourceTypePlugin = "PLUGIN SOURCE"
+)
+
+// Lockfile is the parsed representation of a Gemfile.lock.
+type Lockfile struct {
+	// Sources is the set of GEM, GIT, PATH and PLUGIN SOURCE sections in the
+	// order they appear in the lockfile.
+	Sources []Source
+
+	// Platforms is the set of platforms listed in the PLATFORMS section.
+	Platforms []string
+
+	// Dependencies is the set of top-level dependencies listed in the
+	// DEPENDENCIES section.
+	Dependencies []Dependency
+
+	// Checksums is the set of gem checksums listed in the CHECKSUMS section.
+	Checksums []Checksum
+
+	// RubyVersion is the Ruby version listed in the RUBY VERSION section.
+	RubyVersion RubyVersion
+
+	// BundledWith is the version of Bundler listed in the BUNDLED WITH
+	// section.
+	BundledWith string
+}
+
+// Source is a section of the lockfile that declares where a set of gems are
+// installed from.
+type Source struct {
+	// Type is the section header, one of the SourceType constants.
+	Type string
+
+	// Remotes is the set of "remote" values of the source. Lockfiles
+	// generated by older versions of Bundler can list more than one remote for
+	// a GEM source.
+	Remotes []string
+
+	// Revision, Ref, Branch, Tag, Glob and Submodules are the options that
+	// can be given to GIT sources.
+	Revision   string
+	Ref        string
+	Branch     string
+	Tag        string
+	Glob       string
+	Submodules bool
+
+	// Specs is the set of gems locked from this source.
+	Specs []Spec
+}
+
+// Remote returns the first remote of the source, or an empty string if there
+// is none.
+func (s Source) Remote() string {
+	if len(s.Remotes) == 0 {
+		return ""
+	}
+
+	return s.Remotes[0]
+}
+
+// Spec is a gem, locked to a specific version, that appears in the "specs"
+// list of a Source.
+type Spec struct {
+	Name     string
+	Version  string
+	Platform string
+
+	// Dependencies is the set of runtime dependencies declared by the gem.
+	Dependencies []Dependency
+}
+
+// Dependency is a gem name along with the set of version requirements
+// declared against it.
+type Dependency struct {
+	Name         string
+	Requirements []string
+
+	// Pinned is true when the dependency is marked with a "!" in the
+	// DEPENDENCIES section, indicating that it is sourced from somewhere other
+	// than the default GEM source.
+	Pinned bool
+}
+
+// Checksum is an entry in the CHECKSUMS section.
+type Checksum struct {
+	Name     string
+	Version  string
+	Platform string
+
+	// Checksums is the set of algorithm-prefixed digests recorded for the
+	// gem, for example "sha256=abc...".
+	Checksums []string
+}
+
+// RubyVersion is the parsed content of the RUBY VERSION section, for example
+// "ruby 3.2.2p53" or "ruby 3.1.4p0 (jruby 9.4.5.0)".
+type RubyVersion struct {
+	// Version is the Ruby language version without the patchlevel suffix.
+	Version string
+
+	// Patchlevel is the value following the "p" suffix of the version, if
+	// any.
+	Patchlevel string
+
+	// Engine and EngineVersion are only set when the engine is something
+	// other than MRI.
+	Engine        string
+	EngineVersion string
+}
+
+// Specs returns every locked gem across all sources.
+func (l Lockfile) Specs() []Spec {
+	var specs []Spec
+	for _, source := range l.Sources {
+		specs = append(specs, source.Specs...)
+	}
+
+	return specs
+}
+
+// SupportsPlatform returns true if the PLATFORMS section allows the locked
+// gems to be installed on the given platform, such as "x86_64-linux", without
+// resolving the Gemfile again. The generic "ruby" platform supports every
+// platform, and a glibc platform is the same whether or not its libc is
+// named, such that "x86_64-linux-gnu" supports "x86_64-linux". Other libc
+// variants, such as "x86_64-linux-musl", do not support the glibc platform.
+func (l Lockfile) SupportsPlatform(platform string) bool {
+	cpu, os, _ := strings.Cut(platform, "-")
+	os = strings.TrimSuffix(os, "-gnu")
+	for _, locked := range l.Platforms {
+		if locked == "ruby" {
+			return true
+		}
+
+		lockedCPU, lockedOS, _ := strings.Cut(locked, "-")
+		if lockedCPU != cpu && lockedCPU != "universal" {
+			continue
+		}
+
+		if strings.TrimSuffix(lockedOS, "-gnu") == os {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,48 @@
+package lockfile_test
+
+import (
+	"testing"
+
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLockfile(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("SupportsPlatform", func() {
+		it("supports platforms that are listed", func() {
+			lock := lockfile.Lockfile{Platforms: []string{"arm64-darwin", "x86_64-linux"}}
+			Expect(lock.SupportsPlatform("x86_64-linux")).To(BeTrue())
+			Expect(lock.SupportsPlatform("aarch64-linux")).To(BeFalse())
+		})
+
+		it("supports every platform when the ruby platform is listed", func() {
+			lock := lockfile.Lockfile{Platforms: []string{"arm64-darwin", "ruby"}}
+			Expect(lock.SupportsPlatform("aarch64-linux")).To(BeTrue())
+		})
+
+		it("supports a glibc platform when it is listed with its libc", func() {
+			lock := lockfile.Lockfile{Platforms: []string{"aarch64-linux-gnu"}}
+			Expect(lock.SupportsPlatform("aarch64-linux")).To(BeTrue())
+			Expect(lock.SupportsPlatform("x86_64-linux")).To(BeFalse())
+		})
+
+		it("does not support a glibc platform when only its musl variant is listed", func() {
+			lock := lockfile.Lockfile{Platforms: []string{"x86_64-linux-musl"}}
+			Expect(lock.SupportsPlatform("x86_64-linux")).To(BeFalse())
+		})
+
+		it("supports every cpu when the universal platform is listed", func() {
+			lock := lockfile.Lockfile{Platforms: []string{"universal-linux"}}
+			Expect(lock.SupportsPlatform("aarch64-linux")).To(BeTrue())
+			Expect(lock.SupportsPlatform("arm64-darwin")).To(BeFalse())
+		})
+
+		it("does not support any platform when none are listed", func() {
+			Expect(lockfile.Lockfile{}.SupportsPlatform("x86_64-linux")).To(BeFalse())
+		})
+	})
+}
@@ -0,0 +1,238 @@
+package lockfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	sectionPlatforms    = "PLATFORMS"
+	sectionDependencies = "DEPENDENCIES"
+	sectionChecksums    = "CHECKSUMS"
+	sectionRubyVersion  = "RUBY VERSION"
+	sectionBundledWith  = "BUNDLED WITH"
+)
+
+var rubyVersionExpression = regexp.MustCompile(`^ruby\s+(\S+?)(?:p(-?\d+))?(?:\s+\((\S+)\s+(\S+)\))?$`)
+
+// Parser parses lockfiles, such as Gemfile.lock or gems.locked.
+type Parser struct{}
+
+// NewParser initializes an instance of Parser.
+func NewParser() Parser {
+	return Parser{}
+}
+
+// Parse reads and parses the lockfile at the given path. Errors name the
+// lockfile by its file name.
+func (p Parser) Parse(path string) (Lockfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Lockfile{}, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	defer file.Close()
+
+	lockfile, err := Read(file)
+	if err != nil {
+		return Lockfile{}, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+
+	return lockfile, nil
+}
+
+// Read parses the lockfile content from the given reader.
+func Read(reader io.Reader) (Lockfile, error) {
+	var (
+		lockfile Lockfile
+		section  string
+		source   *Source
+		number   int
+	)
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		number++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "<<<<<<<") || strings.HasPrefix(line, "=======") || strings.HasPrefix(line, ">>>>>>>") {
+			return Lockfile{}, fmt.Errorf("line %d: lockfile contains merge conflicts", number)
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		content := line[indent:]
+
+		if indent == 0 {
+			section = content
+			source = nil
+
+			switch section {
+			case SourceTypeGem, SourceTypeGit, SourceTypePath, SourceTypePlugin:
+				lockfile.Sources = append(lockfile.Sources, Source{Type: section})
+				source = &lockfile.Sources[len(lockfile.Sources)-1]
+			}
+
+			continue
+		}
+
+		switch section {
+		case SourceTypeGem, SourceTypeGit, SourceTypePath, SourceTypePlugin:
+			err := parseSourceLine(source, indent, content)
+			if err != nil {
+				return Lockfile{}, fmt.Errorf("line %d: %w", number, err)
+			}
+
+		case sectionPlatforms:
+			lockfile.Platforms = append(lockfile.Platforms, content)
+
+		case sectionDependencies:
+			lockfile.Dependencies = append(lockfile.Dependencies, parseDependency(content))
+
+		case sectionChecksums:
+			lockfile.Checksums = append(lockfile.Checksums, parseChecksum(content))
+
+		case sectionRubyVersion:
+			version, err := ParseRubyVersion(content)
+			if err != nil {
+				return Lockfile{}, fmt.Errorf("line %d: %w", number, err)
+			}
+			lockfile.RubyVersion = version
+
+		case sectionBundledWith:
+			lockfile.BundledWith = content
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Lockfile{}, err
+	}
+
+	return lockfile, nil
+}
+
+// ParseRubyVersion parses a Ruby version as written in the RUBY VERSION
+// section of a lockfile, for example "ruby 3.2.2p53" or
+// "ruby 3.1.4p0 (jruby 9.4.5.0)".
+func ParseRubyVersion(value string) (RubyVersion, error) {
+	matches := rubyVersionExpression.FindStringSubmatch(strings.TrimSpace(value))
+	if matches == nil {
+		return RubyVersion{}, fmt.Errorf("invalid ruby version %q", value)
+	}
+
+	return RubyVersion{
+		Version:       matches[1],
+		Patchlevel:    matches[2],
+		Engine:        matches[3],
+		EngineVersion: matches[4],
+	}, nil
+}
+
+func parseSourceLine(source *Source, indent int, content string) error {
+	switch indent {
+	case 2:
+		key, value, found := strings.Cut(content, ":")
+		if !found {
+			return fmt.Errorf("malformed source option %q", content)
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "remote":
+			source.Remotes = append(source.Remotes, value)
+		case "revision":
+			source.Revision = value
+		case "ref":
+			source.Ref = value
+		case "branch":
+			source.Branch = value
+		case "tag":
+			source.Tag = value
+		case "glob":
+			source.Glob = value
+		case "submodules":
+			source.Submodules = value == "true"
+		}
+
+	case 4:
+		name, inside, _ := splitNameParenthetical(content)
+		version, platform, _ := strings.Cut(inside, "-")
+		source.Specs = append(source.Specs, Spec{
+			Name:     name,
+			Version:  version,
+			Platform: platform,
+		})
+
+	case 6:
+		if len(source.Specs) == 0 {
+			return fmt.Errorf("dependency %q does not belong to a spec", content)
+		}
+
+		spec := &source.Specs[len(source.Specs)-1]
+		spec.Dependencies = append(spec.Dependencies, parseDependency(content))
+
+	default:
+		return fmt.Errorf("unexpected indentation for %q", content)
+	}
+
+	return nil
+}
+
+func parseDependency(content string) Dependency {
+	name, inside, rest := splitNameParenthetical(content)
+
+	dependency := Dependency{
+		Name:   strings.TrimSuffix(name, "!"),
+		Pinned: strings.HasSuffix(name, "!") || rest == "!",
+	}
+
+	if inside != "" {
+		for _, requirement := range strings.Split(inside, ",") {
+			dependency.Requirements = append(dependency.Requirements, strings.TrimSpace(requirement))
+		}
+	}
+
+	return dependency
+}
+
+func parseChecksum(content string) Checksum {
+	name, inside, rest := splitNameParenthetical(content)
+	version, platform, _ := strings.Cut(inside, "-")
+
+	checksum := Checksum{
+		Name:     name,
+		Version:  version,
+		Platform: platform,
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest != "" {
+		checksum.Checksums = strings.Split(rest, ",")
+	}
+
+	return checksum
+}
+
+// splitNameParenthetical splits content of the form "name (inside)rest" into
+// its parts. If there is no parenthetical, the whole content is returned as
+// the name.
+func splitNameParenthetical(content string) (name, inside, rest string) {
+	open := strings.Index(content, " (")
+	if open == -1 {
+		return content, "", ""
+	}
+
+	end := strings.Index(content[open:], ")")
+	if end == -1 {
+		return content, "", ""
+	}
+	end += open
+
+	return content[:open], content[open+2 : end], content[end+1:]
+}
@@ -0,0 +1,262 @@
+package lockfile_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+const LOCKFILE = `GIT
+  remote: https://github.com/example/internal-gem.git
+  revision: 0123456789abcdef0123456789abcdef01234567
+  branch: main
+  submodules: true
+  specs:
+    internal-gem (1.2.0)
+      rack (>= 2.0)
+
+PATH
+  remote: engines/billing
+  specs:
+    billing (0.1.0)
+      rails (>= 7.0, < 8)
+
+GEM
+  remote: https://rubygems.org/
+  specs:
+    nokogiri (1.15.4-aarch64-linux)
+      racc (~> 1.4)
+    nokogiri (1.15.4-x86_64-linux)
+      racc (~> 1.4)
+    racc (1.7.1)
+    rack (3.0.8)
+    rails (7.1.0)
+
+PLATFORMS
+  aarch64-linux
+  x86_64-linux
+
+DEPENDENCIES
+  billing!
+  internal-gem!
+  nokogiri
+  rails (~> 7.1, >= 7.1.0)
+
+CHECKSUMS
+  nokogiri (1.15.4-x86_64-linux) sha256=abc,sha512=def
+  racc (1.7.1) sha256=123
+  rails (7.1.0)
+
+RUBY VERSION
+   ruby 3.2.2p53
+
+BUNDLED WITH
+   2.5.3
+`
+
+func testParser(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path   string
+		parser lockfile.Parser
+	)
+
+	it.Before(func() {
+		path = filepath.Join(t.TempDir(), "Gemfile.lock")
+		Expect(os.WriteFile(path, []byte(LOCKFILE), 0600)).To(Succeed())
+
+		parser = lockfile.NewParser()
+	})
+
+	context("Parse", func() {
+		it("parses every section of the lockfile", func() {
+			result, err := parser.Parse(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result).To(Equal(lockfile.Lockfile{
+				Sources: []lockfile.Source{
+					{
+						Type:       "GIT",
+						Remotes:    []string{"https://github.com/example/internal-gem.git"},
+						Revision:   "0123456789abcdef0123456789abcdef01234567",
+						Branch:     "main",
+						Submodules: true,
+						Specs: []lockfile.Spec{
+							{
+								Name:    "internal-gem",
+								Version: "1.2.0",
+								Dependencies: []lockfile.Dependency{
+									{Name: "rack", Requirements: []string{">= 2.0"}},
+								},
+							},
+						},
+					},
+					{
+						Type:    "PATH",
+						Remotes: []string{"engines/billing"},
+						Specs: []lockfile.Spec{
+							{
+								Name:    "billing",
+								Version: "0.1.0",
+								Dependencies: []lockfile.Dependency{
+									{Name: "rails", Requirements: []string{">= 7.0", "< 8"}},
+								},
+							},
+						},
+					},
+					{
+						Type:    "GEM",
+						Remotes: []string{"https://rubygems.org/"},
+						Specs: []lockfile.Spec{
+							{
+								Name:     "nokogiri",
+								Version:  "1.15.4",
+								Platform: "aarch64-linux",
+								Dependencies: []lockfile.Dependency{
+									{Name: "racc", Requirements: []string{"~> 1.4"}},
+								},
+							},
+							{
+								Name:     "nokogiri",
+								Version:  "1.15.4",
+								Platform: "x86_64-linux",
+								Dependencies: []lockfile.Dependency{
+									{Name: "racc", Requirements: []string{"~> 1.4"}},
+								},
+							},
+							{Name: "racc", Version: "1.7.1"},
+							{Name: "rack", Version: "3.0.8"},
+							{Name: "rails", Version: "7.1.0"},
+						},
+					},
+				},
+				Platforms: []string{"aarch64-linux", "x86_64-linux"},
+				Dependencies: []lockfile.Dependency{
+					{Name: "billing", Pinned: true},
+					{Name: "internal-gem", Pinned: true},
+					{Name: "nokogiri"},
+					{Name: "rails", Requirements: []string{"~> 7.1", ">= 7.1.0"}},
+				},
+				Checksums: []lockfile.Checksum{
+					{Name: "nokogiri", Version: "1.15.4", Platform: "x86_64-linux", Checksums: []string{"sha256=abc", "sha512=def"}},
+					{Name: "racc", Version: "1.7.1", Checksums: []string{"sha256=123"}},
+					{Name: "rails", Version: "7.1.0"},
+				},
+				RubyVersion: lockfile.RubyVersion{
+					Version:    "3.2.2",
+					Patchlevel: "53",
+				},
+				BundledWith: "2.5.3",
+			}))
+
+			Expect(result.Sources[0].Remote()).To(Equal("https://github.com/example/internal-gem.git"))
+			Expect(result.Specs()).To(HaveLen(7))
+		})
+
+		context("when the lockfile has windows line endings and unknown sections", func() {
+			it.Before(func() {
+				content := strings.ReplaceAll(LOCKFILE, "\n", "\r\n") + "\r\nSOME FUTURE SECTION\r\n  some-value\r\n"
+				Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+			})
+
+			it("parses the known sections", func() {
+				result, err := parser.Parse(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Platforms).To(Equal([]string{"aarch64-linux", "x86_64-linux"}))
+				Expect(result.BundledWith).To(Equal("2.5.3"))
+			})
+		})
+
+		context("when the lockfile does not exist", func() {
+			it.Before(func() {
+				Expect(os.Remove(path)).To(Succeed())
+			})
+
+			it("returns an ErrNotExist error", func() {
+				_, err := parser.Parse(path)
+				Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the lockfile cannot be opened", func() {
+				it.Before(func() {
+					Expect(os.Chmod(path, 0000)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := parser.Parse(path)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse Gemfile.lock:")))
+					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+				})
+			})
+
+			context("when the lockfile contains merge conflicts", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(path, []byte("GEM\n<<<<<<< HEAD\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := parser.Parse(path)
+					Expect(err).To(MatchError("failed to parse Gemfile.lock: line 2: lockfile contains merge conflicts"))
+				})
+			})
+
+			context("when a spec dependency has no spec", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(path, []byte("GEM\n  specs:\n      rack (>= 2.0)\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := parser.Parse(path)
+					Expect(err).To(MatchError(`failed to parse Gemfile.lock: line 3: dependency "rack (>= 2.0)" does not belong to a spec`))
+				})
+			})
+
+			context("when the lockfile is not named Gemfile.lock", func() {
+				it.Before(func() {
+					path = filepath.Join(filepath.Dir(path), "gems.locked")
+					Expect(os.WriteFile(path, []byte("GEM\n<<<<<<< HEAD\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error that names it", func() {
+					_, err := parser.Parse(path)
+					Expect(err).To(MatchError("failed to parse gems.locked: line 2: lockfile contains merge conflicts"))
+				})
+			})
+
+			context("when the ruby version is malformed", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(path, []byte("RUBY VERSION\n   3.2.2\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := parser.Parse(path)
+					Expect(err).To(MatchError(`failed to parse Gemfile.lock: line 2: invalid ruby version "3.2.2"`))
+				})
+			})
+		})
+	})
+
+	context("ParseRubyVersion", func() {
+		it("parses the version, patchlevel and engine", func() {
+			Expect(lockfile.ParseRubyVersion("ruby 3.2.2p53")).To(Equal(lockfile.RubyVersion{Version: "3.2.2", Patchlevel: "53"}))
+			Expect(lockfile.ParseRubyVersion("ruby 3.3.0")).To(Equal(lockfile.RubyVersion{Version: "3.3.0"}))
+			Expect(lockfile.ParseRubyVersion("ruby 3.4.0preview1")).To(Equal(lockfile.RubyVersion{Version: "3.4.0preview1"}))
+			Expect(lockfile.ParseRubyVersion("ruby 3.1.4p0 (jruby 9.4.5.0)")).To(Equal(lockfile.RubyVersion{
+				Version:       "3.1.4",
+				Patchlevel:    "0",
+				Engine:        "jruby",
+				EngineVersion: "9.4.5.0",
+			}))
+		})
+	})
+}
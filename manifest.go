@@ -0,0 +1,127 @@
+package bundleinstall
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/fs"
+)
+
+const (
+	gemfileName     = "Gemfile"
+	gemfileLockName = "Gemfile.lock"
+	gemsRBName      = "gems.rb"
+	gemsLockedName  = "gems.locked"
+)
+
+// Manifest identifies the Gemfile and lockfile used by the application.
+type Manifest struct {
+	Gemfile  string
+	Lockfile string
+
+	// Locked is true when the lockfile exists. Otherwise, Bundler will
+	// resolve the Gemfile and generate the lockfile during installation.
+	Locked bool
+
+	// Configured is true when the Gemfile location was given explicitly,
+	// rather than discovered in the application directory. Bundler must then
+	// be told about the location using BUNDLE_GEMFILE.
+	Configured bool
+}
+
+// LocateManifest determines the Gemfile and lockfile used by the application
+// in the given directory.
+//
+// The Gemfile location is taken, in order of precedence, from the given
+// gemfilePath, from the BUNDLE_GEMFILE setting in the application's
+// .bundle/config, from the given bundleGemfile, the BUNDLE_GEMFILE environment
+// variable, as Bundler prefers the local configuration over the environment,
+// or by discovering which of the Gemfile/Gemfile.lock or gems.rb/gems.locked
+// naming styles the application uses. Relative paths are resolved against the
+// working directory.
+//
+// When discovering, if neither naming style is present, the Gemfile naming
+// style is assumed. Having files of both naming styles is an error as Bundler
+// would silently ignore one of them.
+func LocateManifest(workingDir, gemfilePath, bundleGemfile string) (Manifest, error) {
+	if gemfilePath == "" {
+		config, err := readBundleConfig(filepath.Join(workingDir, ".bundle", "config"))
+		if err != nil {
+			return Manifest{}, err
+		}
+
+		gemfilePath = config["BUNDLE_GEMFILE"]
+	}
+
+	if gemfilePath == "" {
+		gemfilePath = bundleGemfile
+	}
+
+	if gemfilePath != "" {
+		if !filepath.IsAbs(gemfilePath) {
+			gemfilePath = filepath.Join(workingDir, gemfilePath)
+		}
+
+		lockfilePath := lockfileFor(gemfilePath)
+		locked, err := fs.Exists(lockfilePath)
+		if err != nil {
+			return Manifest{}, err
+		}
+
+		return Manifest{
+			Gemfile:    gemfilePath,
+			Lockfile:   lockfilePath,
+			Locked:     locked,
+			Configured: true,
+		}, nil
+	}
+
+	gemfile, err := fs.Exists(filepath.Join(workingDir, gemfileName))
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	gemfileLock, err := fs.Exists(filepath.Join(workingDir, gemfileLockName))
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	gemsRB, err := fs.Exists(filepath.Join(workingDir, gemsRBName))
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	gemsLocked, err := fs.Exists(filepath.Join(workingDir, gemsLockedName))
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	if (gemfile || gemfileLock) && (gemsRB || gemsLocked) {
+		return Manifest{}, fmt.Errorf("found both %s and %s files: remove either %s and %s or %s and %s", gemfileName, gemsRBName, gemfileName, gemfileLockName, gemsRBName, gemsLockedName)
+	}
+
+	if gemsRB || gemsLocked {
+		return Manifest{
+			Gemfile:  filepath.Join(workingDir, gemsRBName),
+			Lockfile: filepath.Join(workingDir, gemsLockedName),
+			Locked:   gemsLocked,
+		}, nil
+	}
+
+	return Manifest{
+		Gemfile:  filepath.Join(workingDir, gemfileName),
+		Lockfile: filepath.Join(workingDir, gemfileLockName),
+		Locked:   gemfileLock,
+	}, nil
+}
+
+// lockfileFor returns the path of the lockfile that Bundler generates for the
+// given Gemfile.
+func lockfileFor(gemfile string) string {
+	if filepath.Base(gemfile) == gemsRBName {
+		return strings.TrimSuffix(gemfile, gemsRBName) + gemsLockedName
+	}
+
+	return gemfile + ".lock"
+}
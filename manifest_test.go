@@ -0,0 +1,212 @@
+package bundleinstall_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testManifest(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		workingDir = t.TempDir()
+	})
+
+	context("LocateManifest", func() {
+		context("when the app has a Gemfile", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), nil, 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), nil, 0600)).To(Succeed())
+			})
+
+			it("returns the Gemfile and Gemfile.lock", func() {
+				manifest, err := bundleinstall.LocateManifest(workingDir, "", "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest).To(Equal(bundleinstall.Manifest{
+					Gemfile:  filepath.Join(workingDir, "Gemfile"),
+					Lockfile: filepath.Join(workingDir, "Gemfile.lock"),
+					Locked:   true,
+				}))
+			})
+		})
+
+		context("when the app has a gems.rb", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "gems.rb"), nil, 0600)).To(Succeed())
+			})
+
+			it("returns the gems.rb and gems.locked", func() {
+				manifest, err := bundleinstall.LocateManifest(workingDir, "", "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest).To(Equal(bundleinstall.Manifest{
+					Gemfile:  filepath.Join(workingDir, "gems.rb"),
+					Lockfile: filepath.Join(workingDir, "gems.locked"),
+				}))
+			})
+		})
+
+		context("when the app has neither", func() {
+			it("defaults to the Gemfile and Gemfile.lock", func() {
+				manifest, err := bundleinstall.LocateManifest(workingDir, "", "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest).To(Equal(bundleinstall.Manifest{
+					Gemfile:  filepath.Join(workingDir, "Gemfile"),
+					Lockfile: filepath.Join(workingDir, "Gemfile.lock"),
+				}))
+			})
+		})
+
+		context("when a Gemfile path is given", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), nil, 0600)).To(Succeed())
+			})
+
+			it("returns that Gemfile and its lockfile", func() {
+				manifest, err := bundleinstall.LocateManifest(workingDir, "Gemfile.next", "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest).To(Equal(bundleinstall.Manifest{
+					Gemfile:    filepath.Join(workingDir, "Gemfile.next"),
+					Lockfile:   filepath.Join(workingDir, "Gemfile.next.lock"),
+					Configured: true,
+				}))
+			})
+
+			context("when the lockfile of that Gemfile exists", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.next.lock"), nil, 0600)).To(Succeed())
+				})
+
+				it("reports that the Gemfile is locked", func() {
+					manifest, err := bundleinstall.LocateManifest(workingDir, "Gemfile.next", "")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(manifest.Locked).To(BeTrue())
+				})
+			})
+
+			context("when the path is absolute and uses the gems.rb naming style", func() {
+				it("returns that gems.rb and its gems.locked", func() {
+					manifest, err := bundleinstall.LocateManifest(workingDir, "/some/app/gems.rb", "")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(manifest).To(Equal(bundleinstall.Manifest{
+						Gemfile:    "/some/app/gems.rb",
+						Lockfile:   "/some/app/gems.locked",
+						Configured: true,
+					}))
+				})
+			})
+		})
+
+		context("when the .bundle/config sets BUNDLE_GEMFILE", func() {
+			it.Before(func() {
+				Expect(os.Mkdir(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte(`---
+BUNDLE_GEMFILE: "app/Gemfile"
+BUNDLE_WITHOUT: "development:test"
+`), 0600)).To(Succeed())
+			})
+
+			it("returns that Gemfile and its lockfile", func() {
+				manifest, err := bundleinstall.LocateManifest(workingDir, "", "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest).To(Equal(bundleinstall.Manifest{
+					Gemfile:    filepath.Join(workingDir, "app", "Gemfile"),
+					Lockfile:   filepath.Join(workingDir, "app", "Gemfile.lock"),
+					Configured: true,
+				}))
+			})
+
+			context("when a Gemfile path is also given", func() {
+				it("prefers the given path", func() {
+					manifest, err := bundleinstall.LocateManifest(workingDir, "Gemfile.next", "")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(manifest.Gemfile).To(Equal(filepath.Join(workingDir, "Gemfile.next")))
+				})
+			})
+
+			context("when the BUNDLE_GEMFILE environment variable is also set", func() {
+				it("prefers the .bundle/config setting, as Bundler does", func() {
+					manifest, err := bundleinstall.LocateManifest(workingDir, "", "sub/Gemfile")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(manifest.Gemfile).To(Equal(filepath.Join(workingDir, "app", "Gemfile")))
+				})
+			})
+		})
+
+		context("when the BUNDLE_GEMFILE environment variable is set", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "sub"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "sub", "Gemfile.lock"), nil, 0600)).To(Succeed())
+			})
+
+			it("returns that Gemfile and its lockfile", func() {
+				manifest, err := bundleinstall.LocateManifest(workingDir, "", "sub/Gemfile")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest).To(Equal(bundleinstall.Manifest{
+					Gemfile:    filepath.Join(workingDir, "sub", "Gemfile"),
+					Lockfile:   filepath.Join(workingDir, "sub", "Gemfile.lock"),
+					Locked:     true,
+					Configured: true,
+				}))
+			})
+
+			context("when a Gemfile path is also given", func() {
+				it("prefers the given path", func() {
+					manifest, err := bundleinstall.LocateManifest(workingDir, "Gemfile.next", "sub/Gemfile")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(manifest.Gemfile).To(Equal(filepath.Join(workingDir, "Gemfile.next")))
+				})
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the .bundle/config is malformed", func() {
+				it.Before(func() {
+					Expect(os.Mkdir(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("%%%"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := bundleinstall.LocateManifest(workingDir, "", "")
+					Expect(err).To(MatchError(ContainSubstring("failed to parse bundle config")))
+				})
+			})
+
+			context("when the app has both naming styles", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), nil, 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "gems.rb"), nil, 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := bundleinstall.LocateManifest(workingDir, "", "")
+					Expect(err).To(MatchError("found both Gemfile and gems.rb files: remove either Gemfile and Gemfile.lock or gems.rb and gems.locked"))
+				})
+			})
+
+			context("when the working directory cannot be read", func() {
+				it.Before(func() {
+					Expect(os.Chmod(workingDir, 0000)).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Chmod(workingDir, os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := bundleinstall.LocateManifest(workingDir, "", "")
+					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,33 @@
+package bundleinstall
+
+import (
+	"io/fs"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink clones the file at the source path into a new file at the
+// destination path, sharing its storage, on filesystems that support it, such
+// as Btrfs and XFS.
+func reflink(source, destination string, mode fs.FileMode) error {
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.OpenFile(destination, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	err = unix.IoctlFileClone(int(output.Fd()), int(input.Fd()))
+	if err != nil {
+		output.Close()
+		os.Remove(destination)
+		return err
+	}
+
+	return output.Close()
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package bundleinstall
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// reflink is not supported outside of Linux.
+func reflink(source, destination string, mode fs.FileMode) error {
+	return errors.ErrUnsupported
+}
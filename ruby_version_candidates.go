@@ -0,0 +1,93 @@
+package bundleinstall
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// RubyVersionCandidate is a Ruby version, or version constraint, declared by
+// one of the version sources of the application.
+type RubyVersionCandidate struct {
+	Version string
+	Source  string
+}
+
+// RubyVersionConflict describes a candidate that is incompatible with the
+// selected Ruby version.
+type RubyVersionConflict struct {
+	Selected RubyVersionCandidate
+	Other    RubyVersionCandidate
+}
+
+func (c RubyVersionConflict) String() string {
+	return fmt.Sprintf("the Ruby version %q in %s conflicts with %q in %s", c.Other.Version, c.Other.Source, c.Selected.Version, c.Selected.Source)
+}
+
+// ResolveRubyVersion selects the Ruby version from the given candidates,
+// which must be given in order of precedence. Detect gathers them in the
+// following order:
+//
+//  1. the "ruby" directive of the Gemfile
+//  2. the .ruby-version file
+//  3. the .tool-versions file
+//  4. the mise.toml file
+//  5. the .mise.toml file
+//  6. the RUBY VERSION section of the Gemfile.lock
+//
+// The first candidate with a version is selected. Every other candidate that
+// cannot be satisfied by the same Ruby version is returned as a conflict.
+// Candidates are only compared when at least one of them is an exact
+// version, as the overlap of two ranges is not checked.
+//
+// Constraints are compared the way the mri buildpack applies them, which is
+// in semver notation rather than that of RubyGems. A pessimistic constraint
+// such as "~> 3.2" therefore only allows patch level changes (>= 3.2.0,
+// < 3.3.0), as that is the range the installed Ruby version is taken from.
+func ResolveRubyVersion(candidates []RubyVersionCandidate) (RubyVersionCandidate, []RubyVersionConflict) {
+	var selected RubyVersionCandidate
+	var conflicts []RubyVersionConflict
+	for _, candidate := range candidates {
+		if candidate.Version == "" {
+			continue
+		}
+
+		if selected.Version == "" {
+			selected = candidate
+			continue
+		}
+
+		if !compatibleRubyVersions(selected.Version, candidate.Version) {
+			conflicts = append(conflicts, RubyVersionConflict{
+				Selected: selected,
+				Other:    candidate,
+			})
+		}
+	}
+
+	return selected, conflicts
+}
+
+// compatibleRubyVersions returns false only when one of the versions is an
+// exact version that the other version constraint does not allow.
+func compatibleRubyVersions(a, b string) bool {
+	evaluated := false
+	for _, pair := range [][2]string{{a, b}, {b, a}} {
+		constraint, err := semver.NewConstraint(pair[0])
+		if err != nil {
+			continue
+		}
+
+		version, err := semver.NewVersion(pair[1])
+		if err != nil {
+			continue
+		}
+
+		if constraint.Check(version) {
+			return true
+		}
+		evaluated = true
+	}
+
+	return !evaluated
+}
@@ -0,0 +1,76 @@
+package bundleinstall_test
+
+import (
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testRubyVersionCandidates(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("ResolveRubyVersion", func() {
+		it("selects the first candidate with a version", func() {
+			selected, conflicts := bundleinstall.ResolveRubyVersion([]bundleinstall.RubyVersionCandidate{
+				{Version: "", Source: "Gemfile"},
+				{Version: "3.2.2", Source: ".ruby-version"},
+				{Version: "3.2.2", Source: "Gemfile.lock"},
+			})
+			Expect(selected).To(Equal(bundleinstall.RubyVersionCandidate{Version: "3.2.2", Source: ".ruby-version"}))
+			Expect(conflicts).To(BeEmpty())
+		})
+
+		it("returns an empty candidate when no candidate has a version", func() {
+			selected, conflicts := bundleinstall.ResolveRubyVersion([]bundleinstall.RubyVersionCandidate{
+				{Version: "", Source: "Gemfile"},
+			})
+			Expect(selected).To(Equal(bundleinstall.RubyVersionCandidate{}))
+			Expect(conflicts).To(BeEmpty())
+		})
+
+		it("returns the candidates that the selected version cannot satisfy", func() {
+			selected, conflicts := bundleinstall.ResolveRubyVersion([]bundleinstall.RubyVersionCandidate{
+				{Version: "~> 3.2.0", Source: "Gemfile"},
+				{Version: "3.3.0", Source: ".ruby-version"},
+				{Version: "3.2.2", Source: "Gemfile.lock"},
+			})
+			Expect(selected).To(Equal(bundleinstall.RubyVersionCandidate{Version: "~> 3.2.0", Source: "Gemfile"}))
+			Expect(conflicts).To(Equal([]bundleinstall.RubyVersionConflict{
+				{
+					Selected: bundleinstall.RubyVersionCandidate{Version: "~> 3.2.0", Source: "Gemfile"},
+					Other:    bundleinstall.RubyVersionCandidate{Version: "3.3.0", Source: ".ruby-version"},
+				},
+			}))
+			Expect(conflicts[0].String()).To(Equal(`the Ruby version "3.3.0" in .ruby-version conflicts with "~> 3.2.0" in Gemfile`))
+		})
+
+		it("treats pessimistic constraints the way the mri buildpack applies them", func() {
+			_, conflicts := bundleinstall.ResolveRubyVersion([]bundleinstall.RubyVersionCandidate{
+				{Version: "~> 3.2", Source: "Gemfile"},
+				{Version: "3.3.0", Source: ".ruby-version"},
+				{Version: "3.2.2", Source: "Gemfile.lock"},
+			})
+			Expect(conflicts).To(HaveLen(1))
+			Expect(conflicts[0].Other.Source).To(Equal(".ruby-version"))
+		})
+
+		it("treats partial versions as matching any later segments", func() {
+			_, conflicts := bundleinstall.ResolveRubyVersion([]bundleinstall.RubyVersionCandidate{
+				{Version: "3.2.2", Source: ".ruby-version"},
+				{Version: "3.2", Source: ".tool-versions"},
+			})
+			Expect(conflicts).To(BeEmpty())
+		})
+
+		it("does not compare two version ranges", func() {
+			_, conflicts := bundleinstall.ResolveRubyVersion([]bundleinstall.RubyVersionCandidate{
+				{Version: ">= 3.1, < 3.2", Source: "Gemfile"},
+				{Version: "3.3.x", Source: "mise.toml"},
+			})
+			Expect(conflicts).To(BeEmpty())
+		})
+	})
+}
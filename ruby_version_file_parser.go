@@ -3,12 +3,20 @@ package bundleinstall
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/pelletier/go-toml"
 )
 
-// RubyVersionFileParser parses the .ruby-version file to determine the
-// version of Ruby used by the application.
+// rubyVersionFiles is the list of version manager files, in order of
+// precedence, that are read as Ruby version candidates alongside the Gemfile
+// and the lockfile.
+var rubyVersionFiles = []string{".ruby-version", ".tool-versions", "mise.toml", ".mise.toml"}
+
+// RubyVersionFileParser parses version manager files, such as .ruby-version,
+// to determine the version of Ruby used by the application.
 type RubyVersionFileParser struct{}
 
 // NewGemfileParser initializes an instance of RubyVersionFileParser.
@@ -16,19 +24,95 @@ func NewRubyVersionFileParser() RubyVersionFileParser {
 	return RubyVersionFileParser{}
 }
 
-// ParseVersion scans the .ruby-version file for a Ruby version specification.
+// ParseVersion scans a version manager file for a Ruby version specification.
+// The format of the file is determined by its name:
+//
+//   - .tool-versions is read as an asdf file, using the first version on the
+//     "ruby" line.
+//   - mise.toml and .mise.toml are read as mise files, using the "ruby" entry
+//     of the [tools] table.
+//   - any other file is read as a .ruby-version file, using the first line
+//     that is not a comment and ignoring a "ruby-" prefix.
 func (p RubyVersionFileParser) ParseVersion(path string) (string, error) {
-	rVersion, err := os.ReadFile(path)
+	name := filepath.Base(path)
+
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to read .ruby-version file: %w", err)
+		return "", fmt.Errorf("failed to read %s file: %w", name, err)
+	}
+
+	var value string
+	switch name {
+	case ".tool-versions":
+		value = parseToolVersions(string(content))
+
+	case "mise.toml", ".mise.toml":
+		value, err = parseMiseToml(content)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s file: %w", name, err)
+		}
+
+	default:
+		value = firstLine(string(content))
 	}
 
-	re := regexp.MustCompile(versionNumberExpression)
-	rubyVersion := re.FindString(strings.TrimSpace(string(rVersion)))
+	value = strings.TrimPrefix(value, "ruby-")
 
+	rubyVersion := regexp.MustCompile(`^` + versionNumberExpression).FindString(value)
 	if len(rubyVersion) == 0 {
-		return "", fmt.Errorf("no valid ruby version found in .ruby-version file: %s", rVersion)
+		return "", fmt.Errorf("no valid ruby version found in %s file: %s", name, content)
 	}
 
 	return rubyVersion, nil
 }
+
+func parseToolVersions(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(stripComment(line))
+		if len(fields) >= 2 && fields[0] == "ruby" {
+			return fields[1]
+		}
+	}
+
+	return ""
+}
+
+func parseMiseToml(content []byte) (string, error) {
+	var config struct {
+		Tools map[string]interface{} `toml:"tools"`
+	}
+
+	err := toml.Unmarshal(content, &config)
+	if err != nil {
+		return "", err
+	}
+
+	switch ruby := config.Tools["ruby"].(type) {
+	case string:
+		return ruby, nil
+	case []interface{}:
+		if len(ruby) > 0 {
+			return fmt.Sprint(ruby[0]), nil
+		}
+	case map[string]interface{}:
+		return fmt.Sprint(ruby["version"]), nil
+	}
+
+	return "", nil
+}
+
+func firstLine(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		if line != "" {
+			return line
+		}
+	}
+
+	return ""
+}
+
+func stripComment(line string) string {
+	before, _, _ := strings.Cut(line, "#")
+	return before
+}
@@ -68,6 +68,86 @@ func testRubyVersionFileParser(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("when the version has a ruby- prefix and comments", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(path, []byte("# managed by rbenv\n\nruby-3.2.2 # current\n"), 0644)).To(Succeed())
+			})
+
+			it("parses correctly", func() {
+				version, err := parser.ParseVersion(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(version).To(Equal("3.2.2"))
+			})
+		})
+
+		context("when the file is a .tool-versions file", func() {
+			it.Before(func() {
+				path = filepath.Join(filepath.Dir(path), ".tool-versions")
+				Expect(os.WriteFile(path, []byte("# asdf\nnodejs 20.10.0\nruby 3.2.2 3.1.4\n"), 0644)).To(Succeed())
+			})
+
+			it("parses the first ruby version", func() {
+				version, err := parser.ParseVersion(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(version).To(Equal("3.2.2"))
+			})
+
+			context("when it does not list ruby", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(path, []byte("nodejs 20.10.0\n"), 0644)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := parser.ParseVersion(path)
+					Expect(err).To(MatchError(ContainSubstring("no valid ruby version found in .tool-versions file:")))
+				})
+			})
+		})
+
+		context("when the file is a mise.toml file", func() {
+			it.Before(func() {
+				path = filepath.Join(filepath.Dir(path), "mise.toml")
+			})
+
+			it("parses the ruby tool version", func() {
+				for _, content := range []string{
+					"[tools]\nruby = \"3.3.0\"\n",
+					"[tools]\nruby = [\"3.3.0\", \"3.2.2\"]\n",
+					"[tools]\nruby = { version = \"3.3.0\" }\n",
+				} {
+					Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+
+					version, err := parser.ParseVersion(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(version).To(Equal("3.3.0"))
+				}
+			})
+
+			context("when the file is a .mise.toml file", func() {
+				it.Before(func() {
+					path = filepath.Join(filepath.Dir(path), ".mise.toml")
+					Expect(os.WriteFile(path, []byte("[tools]\nruby = \"3.3\"\n"), 0644)).To(Succeed())
+				})
+
+				it("parses the ruby tool version", func() {
+					version, err := parser.ParseVersion(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(version).To(Equal("3.3"))
+				})
+			})
+
+			context("when the file is not valid TOML", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(path, []byte("[tools\n"), 0644)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := parser.ParseVersion(path)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse mise.toml file:")))
+				})
+			})
+		})
+
 		context("when the .ruby-version file does not exist", func() {
 			it.Before(func() {
 				Expect(os.Remove(path)).To(Succeed())
@@ -1,16 +1,93 @@
 package bundleinstall
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
-	"regexp"
+	"strings"
 
-	"github.com/Masterminds/semver/v3"
 	"github.com/paketo-buildpacks/packit/v2/pexec"
 )
 
-// RubyVersionResolver identifies and compares versions of Ruby used in the
-// build environment.
+// rbConfigScript prints the facts about the installed Ruby that determine
+// whether compiled gems can be reused, one "key=value" line per fact.
+const rbConfigScript = `require "rbconfig"
+puts "version=#{RUBY_VERSION}"
+puts "engine=#{RUBY_ENGINE}"
+%w[ruby_version arch ENABLE_SHARED MAINLIBS YJIT_SUPPORT].each do |key|
+  puts "#{key}=#{RbConfig::CONFIG[key]}"
+end`
+
+// RubyABI is the set of facts about the installed Ruby that gems with native
+// extensions are compiled against.
+type RubyABI struct {
+	// Version is the Ruby language version, RUBY_VERSION. For alternative
+	// engines, such as JRuby and TruffleRuby, this is the version of the Ruby
+	// language that the engine is compatible with.
+	Version string
+
+	// ABIVersion is the version of the Ruby ABI, such as "3.3.0", which is
+	// shared by every patch release of a minor version.
+	ABIVersion string
+
+	// Platform is the platform that Ruby was built for, such as
+	// "x86_64-linux".
+	Platform string
+
+	// Engine is the Ruby engine, such as "ruby" or "jruby".
+	Engine string
+
+	// Shared, Libs and YJIT are the build configuration of Ruby: whether it
+	// was built as a shared library, the libraries it is linked against, such
+	// as jemalloc, and whether it supports YJIT.
+	Shared string
+	Libs   string
+	YJIT   string
+}
+
+// facts returns the names and values of the facts that make up the
+// ABI, other than the language version.
+func (a RubyABI) facts() [][2]string {
+	return [][2]string{
+		{"abi_version", a.ABIVersion},
+		{"platform", a.Platform},
+		{"engine", a.Engine},
+		{"shared", a.Shared},
+		{"libs", a.Libs},
+		{"yjit", a.YJIT},
+	}
+}
+
+// Metadata returns the facts that make up the ABI, other than the language
+// version, to be stored in the layer metadata.
+func (a RubyABI) Metadata() map[string]interface{} {
+	metadata := map[string]interface{}{}
+	for _, fact := range a.facts() {
+		metadata[fact[0]] = fact[1]
+	}
+
+	return metadata
+}
+
+// Changed returns the names of the facts that differ from the given
+// metadata, as stored by a previous build. Every fact has changed when there
+// is no such metadata.
+func (a RubyABI) Changed(metadata interface{}) []string {
+	cached, _ := metadata.(map[string]interface{})
+
+	var changed []string
+	for _, fact := range a.facts() {
+		value, ok := cached[fact[0]].(string)
+		if !ok || value != fact[1] {
+			changed = append(changed, fact[0])
+		}
+	}
+
+	return changed
+}
+
+// RubyVersionResolver identifies the version of Ruby used in the build
+// environment.
 type RubyVersionResolver struct {
 	executable Executable
 }
@@ -22,45 +99,45 @@ func NewRubyVersionResolver(executable Executable) RubyVersionResolver {
 	}
 }
 
-// Lookup returns the version of Ruby installed in the build environment.
-func (r RubyVersionResolver) Lookup() (string, error) {
+// Lookup returns the RubyABI of the Ruby installed in the build environment,
+// as reported by RbConfig.
+func (r RubyVersionResolver) Lookup() (RubyABI, error) {
 	buffer := bytes.NewBuffer(nil)
+	errorBuffer := bytes.NewBuffer(nil)
 	err := r.executable.Execute(pexec.Execution{
-		Args:   []string{"--version"},
+		Args:   []string{"-e", rbConfigScript},
 		Stdout: buffer,
-		Stderr: buffer,
+		Stderr: errorBuffer,
 	})
-
-	if err != nil {
-		return "", fmt.Errorf("failed to obtain ruby version: %w: %s", err, buffer.String())
-	}
-
-	versions := regexp.MustCompile(`ruby (\d+\.\d+\.\d+)`).FindStringSubmatch(buffer.String())
-	if versions == nil {
-		return "", fmt.Errorf("no string matching 'ruby (\\d+\\.\\d+\\.\\d+)' found")
-	}
-
-	// return just the numeric version part of the `ruby --version` output
-	return versions[1], nil
-}
-
-// CompareMajorMinor returns true if the current major or minor version of Ruby
-// has changed from the cached version.
-func (r RubyVersionResolver) CompareMajorMinor(cachedVersion, newVersion string) (bool, error) {
-	cachedSemverVersion, err := semver.NewVersion(cachedVersion)
 	if err != nil {
-		return false, err
+		return RubyABI{}, fmt.Errorf("failed to obtain ruby version: %w: %s", err, errorBuffer.String())
 	}
 
-	majorMinorConstraint, err := semver.NewConstraint(fmt.Sprintf("%d.%d.*", cachedSemverVersion.Major(), cachedSemverVersion.Minor()))
-	if err != nil {
-		return false, err
+	var abi RubyABI
+	scanner := bufio.NewScanner(buffer)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "version":
+			abi.Version = value
+		case "engine":
+			abi.Engine = value
+		case "ruby_version":
+			abi.ABIVersion = value
+		case "arch":
+			abi.Platform = value
+		case "ENABLE_SHARED":
+			abi.Shared = value
+		case "MAINLIBS":
+			abi.Libs = value
+		case "YJIT_SUPPORT":
+			abi.YJIT = value
+		}
 	}
 
-	newSemverVersion, err := semver.NewVersion(newVersion)
-	if err != nil {
-		return false, err
+	if abi.Version == "" {
+		return RubyABI{}, fmt.Errorf("no ruby version found in RbConfig output: %q", buffer.String())
 	}
 
-	return majorMinorConstraint.Check(newSemverVersion), nil
+	return abi, nil
 }
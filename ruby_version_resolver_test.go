@@ -26,7 +26,13 @@ func testRubyVersionResolver(t *testing.T, context spec.G, it spec.S) {
 		it.Before(func() {
 			executable = &fakes.Executable{}
 			executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
-				_, err := fmt.Fprintf(execution.Stdout, "ruby 2.7.7p57 (2018-03-29 revision 63029) [x86_64-linux-gnu]")
+				_, err := fmt.Fprintln(execution.Stdout, `version=3.3.4
+engine=ruby
+ruby_version=3.3.0
+arch=x86_64-linux
+ENABLE_SHARED=yes
+MAINLIBS=-lz -lrt -lrt -ldl -lcrypt -lm -lpthread
+YJIT_SUPPORT=yes`)
 				Expect(err).NotTo(HaveOccurred())
 				return nil
 			}
@@ -35,18 +41,56 @@ func testRubyVersionResolver(t *testing.T, context spec.G, it spec.S) {
 		})
 
 		context("Lookup", func() {
-
-			it("returns the ruby version", func() {
-				version, err := rubyVersionResolver.Lookup()
+			it("returns the ruby ABI", func() {
+				abi, err := rubyVersionResolver.Lookup()
 				Expect(err).NotTo(HaveOccurred())
 
-				Expect(version).To(Equal("2.7.7"))
+				Expect(abi).To(Equal(bundleinstall.RubyABI{
+					Version:    "3.3.4",
+					ABIVersion: "3.3.0",
+					Platform:   "x86_64-linux",
+					Engine:     "ruby",
+					Shared:     "yes",
+					Libs:       "-lz -lrt -lrt -ldl -lcrypt -lm -lpthread",
+					YJIT:       "yes",
+				}))
+
+				Expect(executable.ExecuteCall.Receives.Execution.Args).To(HaveLen(2))
+				Expect(executable.ExecuteCall.Receives.Execution.Args[0]).To(Equal("-e"))
+				Expect(executable.ExecuteCall.Receives.Execution.Args[1]).To(ContainSubstring(`require "rbconfig"`))
+			})
+
+			context("when the engine is JRuby", func() {
+				it.Before(func() {
+					executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+						_, err := fmt.Fprintln(execution.Stdout, `version=3.1.4
+engine=jruby
+ruby_version=3.1.0
+arch=x86_64-linux
+ENABLE_SHARED=no
+MAINLIBS=
+YJIT_SUPPORT=`)
+						Expect(err).NotTo(HaveOccurred())
+						return nil
+					}
+				})
 
-				Expect(executable.ExecuteCall.Receives.Execution.Args).To(Equal([]string{"--version"}))
+				it("returns the compatible ruby version", func() {
+					abi, err := rubyVersionResolver.Lookup()
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(abi).To(Equal(bundleinstall.RubyABI{
+						Version:    "3.1.4",
+						ABIVersion: "3.1.0",
+						Platform:   "x86_64-linux",
+						Engine:     "jruby",
+						Shared:     "no",
+					}))
+				})
 			})
 
 			context("failure cases", func() {
-				context("fails to execute `ruby --version`", func() {
+				context("fails to execute ruby", func() {
 					it.Before(func() {
 						executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
 							_, err := fmt.Fprintf(execution.Stderr, "failed to execute")
@@ -63,10 +107,10 @@ func testRubyVersionResolver(t *testing.T, context spec.G, it spec.S) {
 					})
 				})
 
-				context("no ruby match is found", func() {
+				context("no ruby version is found", func() {
 					it.Before(func() {
 						executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
-							_, err := fmt.Fprintf(execution.Stdout, "")
+							_, err := fmt.Fprintf(execution.Stdout, "engine=ruby\n")
 							Expect(err).NotTo(HaveOccurred())
 							return nil
 						}
@@ -74,49 +118,7 @@ func testRubyVersionResolver(t *testing.T, context spec.G, it spec.S) {
 
 					it("returns an error", func() {
 						_, err := rubyVersionResolver.Lookup()
-						Expect(err).To(MatchError(ContainSubstring("no string matching 'ruby (\\d+\\.\\d+\\.\\d+)' found")))
-					})
-				})
-			})
-		})
-
-		context("CompareMajorMinor", func() {
-			context("versions are an exact match", func() {
-				it("returns true", func() {
-					Expect(rubyVersionResolver.CompareMajorMinor("1.2.3", "1.2.3")).To(BeTrue())
-				})
-			})
-
-			context("the patch versions differ", func() {
-				it("returns true", func() {
-					Expect(rubyVersionResolver.CompareMajorMinor("1.2.3", "1.2.4")).To(BeTrue())
-				})
-			})
-
-			context("the minor versions differ", func() {
-				it("returns false", func() {
-					Expect(rubyVersionResolver.CompareMajorMinor("1.2.3", "1.3.5")).To(BeFalse())
-				})
-			})
-
-			context("the major versions differ", func() {
-				it("returns false", func() {
-					Expect(rubyVersionResolver.CompareMajorMinor("1.2.3", "2.5.5")).To(BeFalse())
-				})
-			})
-
-			context("failure cases", func() {
-				context("cached version is not semver compatible", func() {
-					it("returns an error", func() {
-						_, err := rubyVersionResolver.CompareMajorMinor("weird-version", "1.2.3")
-						Expect(err).To(HaveOccurred())
-					})
-				})
-
-				context("new version version is not semver compatible", func() {
-					it("returns an error", func() {
-						_, err := rubyVersionResolver.CompareMajorMinor("1.2.3", "weird-version")
-						Expect(err).To(HaveOccurred())
+						Expect(err).To(MatchError(ContainSubstring("no ruby version found in RbConfig output")))
 					})
 				})
 			})
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/paketo-buildpacks/bundle-install/lockfile"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/draft"
@@ -33,7 +34,9 @@ func main() {
 		bundleinstall.Detect(
 			bundleinstall.NewGemfileParser(),
 			bundleinstall.NewRubyVersionFileParser(),
+			lockfile.NewParser(),
 			logEmitter,
+			environment,
 		),
 		bundleinstall.Build(
 			draft.NewPlanner(),
@@ -44,8 +47,16 @@ func main() {
 					pexec.NewExecutable("ruby"),
 				),
 				fs.NewChecksumCalculator(),
+				bundleinstall.NewGemfileParser(),
+				lockfile.NewParser(),
 			),
 			Generator{},
+			lockfile.NewParser(),
+			bundleinstall.NewGemfileParser(),
+			bundleinstall.NewGitSourceCache(
+				pexec.NewExecutable("git"),
+				logEmitter,
+			),
 			logEmitter,
 			chronos.DefaultClock,
 			environment,
@@ -0,0 +1,108 @@
+package bundleinstall
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// rubyEngines is the set of Ruby engines that Bundler can install gems for,
+// each of which installs into a directory of the same name.
+var rubyEngines = []string{"ruby", "jruby", "truffleruby"}
+
+// StaleGems is the set of gem install roots that were removed from a layer,
+// and the space that removing them reclaimed.
+type StaleGems struct {
+	// Roots is the set of removed install roots, relative to the layer, such
+	// as "ruby/3.1.0".
+	Roots []string
+
+	// Size is the total size, in bytes, of the files in the removed roots.
+	Size int64
+}
+
+// PruneStaleGems removes the gem install roots from the layer at the given
+// path that do not match the given RubyABI. Bundler installs gems into an
+// "<engine>/<ABI version>" directory of the layer, such as "ruby/3.2.0", so
+// that the gems of a previous Ruby remain in a cached layer after Ruby is
+// upgraded. Nothing is removed when the ABI is not known.
+func PruneStaleGems(path string, abi RubyABI) (StaleGems, error) {
+	var stale StaleGems
+	if abi.Engine == "" || abi.ABIVersion == "" {
+		return stale, nil
+	}
+
+	for _, engine := range rubyEngines {
+		entries, err := os.ReadDir(filepath.Join(path, engine))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return StaleGems{}, fmt.Errorf("failed to prune stale gems: %w", err)
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() || (engine == abi.Engine && entry.Name() == abi.ABIVersion) {
+				continue
+			}
+
+			root := filepath.Join(path, engine, entry.Name())
+			size, err := directorySize(root)
+			if err != nil {
+				return StaleGems{}, fmt.Errorf("failed to prune stale gems: %w", err)
+			}
+
+			err = os.RemoveAll(root)
+			if err != nil {
+				return StaleGems{}, fmt.Errorf("failed to prune stale gems: %w", err)
+			}
+
+			stale.Roots = append(stale.Roots, filepath.Join(engine, entry.Name()))
+			stale.Size += size
+		}
+	}
+
+	return stale, nil
+}
+
+func directorySize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
+
+// formatSize returns the given number of bytes in a human readable form, such
+// as "1.5 MB".
+func formatSize(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value, prefix := float64(size)/unit, 0
+	for value >= unit && prefix < len("MGTPE") {
+		value /= unit
+		prefix++
+	}
+
+	return fmt.Sprintf("%.1f %cB", value, "kMGTPE"[prefix])
+}
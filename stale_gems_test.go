@@ -0,0 +1,104 @@
+package bundleinstall_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	bundleinstall "github.com/paketo-buildpacks/bundle-install"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testStaleGems(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path string
+		abi  bundleinstall.RubyABI
+	)
+
+	it.Before(func() {
+		path = t.TempDir()
+		abi = bundleinstall.RubyABI{Engine: "ruby", ABIVersion: "3.2.0"}
+
+		for _, root := range []string{"ruby/3.2.0/gems", "ruby/3.1.0/gems", "jruby/3.1.0/gems"} {
+			Expect(os.MkdirAll(filepath.Join(path, root), os.ModePerm)).To(Succeed())
+		}
+
+		Expect(os.WriteFile(filepath.Join(path, "ruby", "3.2.0", "gems", "some-file"), []byte("some-contents"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, "ruby", "3.1.0", "gems", "some-file"), []byte("some-contents"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, "jruby", "3.1.0", "gems", "other-file"), []byte("other-contents"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, "config"), nil, 0600)).To(Succeed())
+	})
+
+	context("PruneStaleGems", func() {
+		it("removes the install roots of other Ruby ABIs", func() {
+			stale, err := bundleinstall.PruneStaleGems(path, abi)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stale).To(Equal(bundleinstall.StaleGems{
+				Roots: []string{"ruby/3.1.0", "jruby/3.1.0"},
+				Size:  27,
+			}))
+
+			Expect(filepath.Join(path, "ruby", "3.2.0", "gems", "some-file")).To(BeAnExistingFile())
+			Expect(filepath.Join(path, "config")).To(BeAnExistingFile())
+			Expect(filepath.Join(path, "ruby", "3.1.0")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(path, "jruby")).To(BeADirectory())
+			Expect(filepath.Join(path, "jruby", "3.1.0")).NotTo(BeAnExistingFile())
+		})
+
+		context("when the ABI is not known", func() {
+			it("removes nothing", func() {
+				stale, err := bundleinstall.PruneStaleGems(path, bundleinstall.RubyABI{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stale.Roots).To(BeEmpty())
+
+				Expect(filepath.Join(path, "ruby", "3.1.0")).To(BeADirectory())
+			})
+		})
+
+		context("when the layer is empty", func() {
+			it("removes nothing", func() {
+				stale, err := bundleinstall.PruneStaleGems(t.TempDir(), abi)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stale).To(Equal(bundleinstall.StaleGems{}))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when an engine directory cannot be read", func() {
+				it.Before(func() {
+					Expect(os.Chmod(filepath.Join(path, "jruby"), 0000)).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Chmod(filepath.Join(path, "jruby"), os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := bundleinstall.PruneStaleGems(path, abi)
+					Expect(err).To(MatchError(ContainSubstring("failed to prune stale gems")))
+					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+				})
+			})
+
+			context("when a stale install root cannot be removed", func() {
+				it.Before(func() {
+					Expect(os.Chmod(filepath.Join(path, "ruby", "3.1.0"), 0500)).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Chmod(filepath.Join(path, "ruby", "3.1.0"), os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := bundleinstall.PruneStaleGems(path, abi)
+					Expect(err).To(MatchError(ContainSubstring("failed to prune stale gems")))
+					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+				})
+			})
+		})
+	})
+}